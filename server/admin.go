@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	// image formats accepted for logos
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/blang/semver"
+	"github.com/gorilla/mux"
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+)
+
+const (
+	minLogoSize = 32
+	maxLogoSize = 1024
+)
+
+var (
+	errCoinNotFound = errors.New("coin not found")
+	errCoinExists   = errors.New("coin already exists")
+	errSymbolExists = errors.New("symbol is already used by another coin")
+
+	// coin names are used in URLs, e.g, /skycoin/getBalance
+	coinNameRe = regexp.MustCompile(`^[a-z0-9]+$`)
+
+	// symbols name logo files, e.g, static/sky.logo.png
+	symbolRe = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+	logoExtensions = map[string]string{
+		"png":  "png",
+		"jpeg": "jpg",
+	}
+)
+
+// registerAdminRoutes adds the admin API, which requires an API key with the admin permission
+func registerAdminRoutes(r *mux.Router) {
+	r.HandleFunc("/admin/coins", adminListCoinsHandler).Methods("GET")
+	r.HandleFunc("/admin/coins", adminAddCoinHandler).Methods("POST")
+	r.HandleFunc("/admin/coins/{name}", adminUpdateCoinHandler).Methods("PUT")
+	r.HandleFunc("/admin/coins/{name}", adminRemoveCoinHandler).Methods("DELETE")
+	r.HandleFunc("/admin/coins/{name}/disable", adminSetCoinDisabledHandler(true)).Methods("POST")
+	r.HandleFunc("/admin/coins/{name}/enable", adminSetCoinDisabledHandler(false)).Methods("POST")
+	r.HandleFunc("/admin/coins/{name}/logo", adminUploadLogoHandler).Methods("PUT")
+
+	r.HandleFunc("/admin/webhooks", adminListWebhooksHandler).Methods("GET")
+	r.HandleFunc("/admin/webhooks", adminAddWebhookHandler).Methods("POST")
+	r.HandleFunc("/admin/webhooks/{id}", adminRemoveWebhookHandler).Methods("DELETE")
+	r.HandleFunc("/admin/deliveries", adminDeliveriesHandler).Methods("GET")
+	r.HandleFunc("/admin/deliveries/{id}/replay", adminReplayDeliveryHandler).Methods("POST")
+}
+
+func validateCoinMeta(cm skywallet.CoinMeta) error {
+	if !coinNameRe.MatchString(cm.NameInEnglish) {
+		return fmt.Errorf("invalid nameInEnglish %q, only lower case letters and digits are allowed", cm.NameInEnglish)
+	}
+
+	if !symbolRe.MatchString(cm.Symbol) {
+		return fmt.Errorf("invalid symbol %q, only letters and digits are allowed", cm.Symbol)
+	}
+
+	if p, err := strconv.Atoi(cm.WebInterfacePort); err != nil || p <= 0 || p > 65535 {
+		return fmt.Errorf("invalid webInterfacePort %q", cm.WebInterfacePort)
+	}
+
+	if cm.Decimals < 0 || cm.Decimals > 18 {
+		return fmt.Errorf("invalid decimals %d", cm.Decimals)
+	}
+
+	if cm.MinSendAmount != "" {
+		if v, err := strconv.ParseFloat(cm.MinSendAmount, 64); err != nil || v < 0 {
+			return fmt.Errorf("invalid minSendAmount %q", cm.MinSendAmount)
+		}
+	}
+
+	if cm.ExplorerTxURL != "" && !strings.Contains(cm.ExplorerTxURL, "{txid}") {
+		return fmt.Errorf("explorerTxURL %q has no {txid} placeholder", cm.ExplorerTxURL)
+	}
+
+	if cm.ExplorerAddressURL != "" && !strings.Contains(cm.ExplorerAddressURL, "{address}") {
+		return fmt.Errorf("explorerAddressURL %q has no {address} placeholder", cm.ExplorerAddressURL)
+	}
+
+	if cm.NodeVersion != "" {
+		if _, err := semver.ParseRange(cm.NodeVersion); err != nil {
+			return fmt.Errorf("invalid nodeVersion %q: %v", cm.NodeVersion, err)
+		}
+	}
+
+	return nil
+}
+
+func readCoinMeta(w http.ResponseWriter, r *http.Request) (skywallet.CoinMeta, bool) {
+	var cm skywallet.CoinMeta
+
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %s", err), http.StatusRequestEntityTooLarge)
+		return cm, false
+	}
+
+	if err := json.Unmarshal(b, &cm); err != nil {
+		http.Error(w, fmt.Sprintf("invalid coin: %s", err), http.StatusBadRequest)
+		return cm, false
+	}
+
+	// set by the server, never stored
+	cm.Degraded = false
+	cm.Incompatible = false
+	cm.DisplayName = ""
+
+	return cm, true
+}
+
+// coinsChanged drops everything derived from the previous settings of a coin
+func coinsChanged(coinType string) {
+	respCache.invalidateCoin("")
+	respCache.invalidateCoin(coinType)
+	watcher.forget(coinType)
+}
+
+func writeAdminResult(w http.ResponseWriter, r *http.Request, v interface{}, err error) {
+	switch err {
+	case nil:
+	case errCoinNotFound, errWebhookNotFound, errDeliveryNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errCoinExists, errSymbolExists:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		requestLogger(r).Errorf("admin request failed: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal result: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+}
+
+// updateCoin applies f to the coin named name and persists the result
+func updateCoin(name string, f func(cm *skywallet.CoinMeta) error) (skywallet.CoinMeta, error) {
+	var updated skywallet.CoinMeta
+	err := coins.update(func(list skywallet.CoinMetas) (skywallet.CoinMetas, error) {
+		for i := range list {
+			if list[i].NameInEnglish == name {
+				if err := f(&list[i]); err != nil {
+					return nil, err
+				}
+				if symbolTaken(list, list[i]) {
+					return nil, errSymbolExists
+				}
+				updated = list[i]
+				return list, nil
+			}
+		}
+		return nil, errCoinNotFound
+	})
+	if err == nil {
+		coinsChanged(name)
+	}
+
+	return updated, err
+}
+
+// symbolTaken reports whether another coin of list has the symbol of cm, logo files
+// are named after the lower case symbol so symbols differing by case collide
+func symbolTaken(list skywallet.CoinMetas, cm skywallet.CoinMeta) bool {
+	for _, c := range list {
+		if c.NameInEnglish != cm.NameInEnglish && strings.EqualFold(c.Symbol, cm.Symbol) {
+			return true
+		}
+	}
+	return false
+}
+
+// adminListCoinsHandler returns every coin, including disabled ones, in config file order
+func adminListCoinsHandler(w http.ResponseWriter, r *http.Request) {
+	writeAdminResult(w, r, coins.all(), nil)
+}
+
+func adminAddCoinHandler(w http.ResponseWriter, r *http.Request) {
+	cm, ok := readCoinMeta(w, r)
+	if !ok {
+		return
+	}
+
+	if err := validateCoinMeta(cm); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := coins.update(func(list skywallet.CoinMetas) (skywallet.CoinMetas, error) {
+		for _, c := range list {
+			if c.NameInEnglish == cm.NameInEnglish {
+				return nil, errCoinExists
+			}
+		}
+		if symbolTaken(list, cm) {
+			return nil, errSymbolExists
+		}
+		return append(list, cm), nil
+	})
+	if err == nil {
+		coinsChanged(cm.NameInEnglish)
+		requestLogger(r).Infof("coin %s added", cm.NameInEnglish)
+	}
+
+	writeAdminResult(w, r, cm, err)
+}
+
+// adminUpdateCoinHandler replaces all fields of a coin, coins can't be renamed
+func adminUpdateCoinHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	cm, ok := readCoinMeta(w, r)
+	if !ok {
+		return
+	}
+
+	if cm.NameInEnglish == "" {
+		cm.NameInEnglish = name
+	}
+	if cm.NameInEnglish != name {
+		http.Error(w, fmt.Sprintf("coin %s can't be renamed to %s", name, cm.NameInEnglish), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateCoinMeta(cm); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := updateCoin(name, func(c *skywallet.CoinMeta) error {
+		*c = cm
+		return nil
+	})
+	if err == nil {
+		requestLogger(r).Infof("coin %s updated", name)
+	}
+
+	writeAdminResult(w, r, updated, err)
+}
+
+func adminSetCoinDisabledHandler(disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+
+		updated, err := updateCoin(name, func(c *skywallet.CoinMeta) error {
+			c.Disabled = disabled
+			return nil
+		})
+		if err == nil {
+			requestLogger(r).Infof("coin %s disabled: %v", name, disabled)
+		}
+
+		writeAdminResult(w, r, updated, err)
+	}
+}
+
+func adminRemoveCoinHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var removed skywallet.CoinMeta
+	err := coins.update(func(list skywallet.CoinMetas) (skywallet.CoinMetas, error) {
+		for i, c := range list {
+			if c.NameInEnglish == name {
+				removed = c
+				return append(list[:i], list[i+1:]...), nil
+			}
+		}
+		return nil, errCoinNotFound
+	})
+	if err == nil {
+		coinsChanged(name)
+		requestLogger(r).Infof("coin %s removed", name)
+	}
+
+	writeAdminResult(w, r, removed, err)
+}
+
+// adminUploadLogoHandler stores the PNG or JPEG image in the request body as the logo of a coin,
+// i.e, static/<symbol>.logo.png, and points the logoURL of the coin to it
+func adminUploadLogoHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	cm, ok := coins.get(name)
+	if !ok {
+		http.Error(w, errCoinNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxLogoBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("logo is larger than %d bytes", cfg.MaxLogoBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	img, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid logo, a PNG or JPEG image is expected: %s", err), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	ext, ok := logoExtensions[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unsupported logo format %s, a PNG or JPEG image is expected", format), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if img.Width != img.Height || img.Width < minLogoSize || img.Width > maxLogoSize {
+		http.Error(w, fmt.Sprintf("logo must be square and between %dx%d and %dx%d pixels, got %dx%d",
+			minLogoSize, minLogoSize, maxLogoSize, maxLogoSize, img.Width, img.Height), http.StatusBadRequest)
+		return
+	}
+
+	// coins of the config file were never validated, their symbol must not lead out of the static directory
+	dir := filepath.Clean(cfg.StaticDir)
+	file := fmt.Sprintf("%s.logo.%s", strings.ToLower(cm.Symbol), ext)
+	path := filepath.Join(dir, file)
+	if !symbolRe.MatchString(cm.Symbol) || filepath.Dir(path) != dir {
+		http.Error(w, fmt.Sprintf("symbol %q of coin %s can't name a logo file", cm.Symbol, name), http.StatusBadRequest)
+		return
+	}
+
+	if err := writeFileAtomic(path, b, 0644); err != nil {
+		requestLogger(r).Errorf("failed to write logo %s: %s", file, err)
+		http.Error(w, fmt.Sprintf("failed to write logo: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := updateCoin(name, func(c *skywallet.CoinMeta) error {
+		c.LogoURL = "/static/" + file
+		return nil
+	})
+	if err == nil {
+		requestLogger(r).Infof("logo of coin %s set to %s", name, file)
+	}
+
+	writeAdminResult(w, r, updated, err)
+}
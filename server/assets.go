@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// placeholderLogo is served for coins without a logo, or whose logo file is missing
+const placeholderLogo = "default.logo.png"
+
+// embeddedAssets holds the static directory built into the binary, it is only set when the server
+// is built with the embedassets tag. Files in cfg.StaticDir take precedence over embedded ones
+var embeddedAssets http.FileSystem
+
+// variantRe matches resolution variants of a logo, e.g, mzc.logo@2x.png for mzc.logo.png
+var variantRe = regexp.MustCompile(`^(.+)@[23]x(\.[a-z]+)$`)
+
+type asset struct {
+	modTime time.Time
+	size    int64
+	data    []byte
+	etag    string
+}
+
+// assetServer serves coin logos from dir, falling back to embedded assets. Only logos referenced by
+// a coin, their @2x/@3x variants and the placeholder are served, anything else in dir stays private
+type assetServer struct {
+	dir    string
+	maxAge time.Duration
+
+	sync.Mutex
+	cache map[string]*asset
+}
+
+func newAssetServer(dir string, maxAge time.Duration) *assetServer {
+	return &assetServer{
+		dir:    dir,
+		maxAge: maxAge,
+		cache:  make(map[string]*asset),
+	}
+}
+
+// knownLogo tells whether name, relative to /static/, is the logo of a coin or the placeholder
+func knownLogo(name string) bool {
+	if name == placeholderLogo {
+		return true
+	}
+	for _, cm := range coins.all() {
+		if cm.LogoURL == "/static/"+name {
+			return true
+		}
+	}
+	return false
+}
+
+// logoURL returns the logo of a coin, or the placeholder when it has none
+func logoURL(logo string) string {
+	if logo == "" {
+		return "/static/" + placeholderLogo
+	}
+	return logo
+}
+
+// load returns the content of name, read from dir and cached until the file changes,
+// or from the embedded assets
+func (as *assetServer) load(name string) (*asset, error) {
+	file := filepath.Join(as.dir, filepath.FromSlash(name))
+	fi, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) && embeddedAssets != nil {
+			return as.loadEmbedded(name)
+		}
+		return nil, err
+	}
+
+	as.Lock()
+	a, ok := as.cache[name]
+	as.Unlock()
+	if ok && a.modTime.Equal(fi.ModTime()) && a.size == fi.Size() {
+		return a, nil
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	a = newAsset(data, fi.ModTime())
+
+	as.Lock()
+	as.cache[name] = a
+	as.Unlock()
+
+	return a, nil
+}
+
+func (as *assetServer) loadEmbedded(name string) (*asset, error) {
+	key := "embedded:" + name
+
+	as.Lock()
+	a, ok := as.cache[key]
+	as.Unlock()
+	if ok {
+		return a, nil
+	}
+
+	f, err := embeddedAssets.Open("/" + name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var modTime time.Time
+	if fi, err := f.Stat(); err == nil {
+		modTime = fi.ModTime()
+	}
+	a = newAsset(data, modTime)
+
+	as.Lock()
+	as.cache[key] = a
+	as.Unlock()
+
+	return a, nil
+}
+
+func newAsset(data []byte, modTime time.Time) *asset {
+	sum := sha256.Sum256(data)
+	return &asset{
+		modTime: modTime,
+		size:    int64(len(data)),
+		data:    data,
+		etag:    fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:16])),
+	}
+}
+
+// ServeHTTP serves /static/<name>. A missing @2x/@3x variant falls back to the logo itself,
+// and a missing logo to the placeholder, so that apps always get an image for a known coin
+func (as *assetServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, "/static/")), "/")
+
+	base := name
+	if m := variantRe.FindStringSubmatch(name); m != nil {
+		base = m[1] + m[2]
+	}
+
+	if !knownLogo(base) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var a *asset
+	var err error
+	for _, candidate := range []string{name, base, placeholderLogo} {
+		if a, err = as.load(candidate); err == nil {
+			name = candidate
+			break
+		}
+	}
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("ETag", a.etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(as.maxAge.Seconds())))
+
+	// ServeContent answers If-None-Match and If-Modified-Since with 304 and sets the content type
+	http.ServeContent(w, r, name, a.modTime, bytes.NewReader(a.data))
+}
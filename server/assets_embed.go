@@ -0,0 +1,24 @@
+//go:build embedassets
+// +build embedassets
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// build with -tags embedassets to ship the logos inside the binary, e.g, when the
+// server runs without a static directory next to it
+
+//go:embed static
+var staticFS embed.FS
+
+func init() {
+	sub, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		panic(err)
+	}
+	embeddedAssets = http.FS(sub)
+}
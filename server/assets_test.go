@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+)
+
+func TestAssetServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "superwallet-static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"sky.logo.png":    "sky",
+		"sky.logo@2x.png": "sky@2x",
+		placeholderLogo:   "placeholder",
+		"secret.txt":      "secret",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(c *coinRegistry) { coins = c }(coins)
+	coins = &coinRegistry{list: skywallet.CoinMetas{
+		{NameInEnglish: "skycoin", LogoURL: "/static/sky.logo.png"},
+		{NameInEnglish: "mzcoin", LogoURL: "/static/mzc.logo.png"},
+	}}
+
+	as := newAssetServer(dir, time.Hour)
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/static/sky.logo.png", http.StatusOK, "sky"},
+		{"/static/sky.logo@2x.png", http.StatusOK, "sky@2x"},
+		{"/static/sky.logo@3x.png", http.StatusOK, "sky"},
+		{"/static/mzc.logo.png", http.StatusOK, "placeholder"},
+		{"/static/secret.txt", http.StatusNotFound, ""},
+		{"/static/../static/secret.txt", http.StatusNotFound, ""},
+	} {
+		w := httptest.NewRecorder()
+		as.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+
+		if w.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d", tc.path, tc.status, w.Code)
+			continue
+		}
+		if tc.status == http.StatusOK && w.Body.String() != tc.body {
+			t.Errorf("%s: expected %q, got %q", tc.path, tc.body, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	as.ServeHTTP(w, httptest.NewRequest("GET", "/static/sky.logo.png", nil))
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Fatalf("unexpected cache headers %v", w.Header())
+	}
+
+	r := httptest.NewRequest("GET", "/static/sky.logo.png", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	as.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", w.Code)
+	}
+}
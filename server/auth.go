@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// permissions of an API key, each one includes the ones before it. inject is the write
+// permission of apps, it also covers changing push notification subscriptions
+const (
+	permRead   = "read"
+	permInject = "inject"
+	permAdmin  = "admin"
+)
+
+var permLevels = map[string]int{
+	permRead:   1,
+	permInject: 2,
+	permAdmin:  3,
+}
+
+// apiKey is an entry of the API keys file, e.g,
+//
+//	{"name": "shellpay-ios", "keyHash": "<hex sha256 of the key>", "permission": "inject", "coins": ["skycoin"], "dailyQuota": 10000}
+//
+// either key or keyHash must be set, keyHash avoids storing keys in clear text
+type apiKey struct {
+	Name       string   `json:"name"`
+	Key        string   `json:"key,omitempty"`
+	KeyHash    string   `json:"keyHash,omitempty"`
+	Permission string   `json:"permission"`
+	Coins      []string `json:"coins,omitempty"`      // empty allows all coins
+	DailyQuota int      `json:"dailyQuota,omitempty"` // requests per UTC day, 0 means no quota
+}
+
+func (k *apiKey) allows(perm string) bool {
+	return permLevels[k.Permission] >= permLevels[perm]
+}
+
+func (k *apiKey) allowsCoin(coinType string) bool {
+	if len(k.Coins) == 0 {
+		return true
+	}
+	for _, c := range k.Coins {
+		if c == coinType {
+			return true
+		}
+	}
+	return false
+}
+
+type apiKeyKey struct{}
+
+// requestAPIKey returns the API key a request was authenticated with, false when keys are not configured
+func requestAPIKey(ctx context.Context) (*apiKey, bool) {
+	k, ok := ctx.Value(apiKeyKey{}).(*apiKey)
+	return k, ok
+}
+
+type quotaUsage struct {
+	day   string
+	count int
+}
+
+// keyStore holds the API keys indexed by the SHA-256 of the key, so that keys are never compared in clear
+type keyStore struct {
+	keys map[string]*apiKey
+
+	sync.Mutex
+	usage map[string]*quotaUsage
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func newKeyStore(keys []apiKey) (*keyStore, error) {
+	ks := &keyStore{
+		keys:  make(map[string]*apiKey),
+		usage: make(map[string]*quotaUsage),
+	}
+
+	for i := range keys {
+		k := &keys[i]
+		if k.Name == "" {
+			return nil, fmt.Errorf("API key #%d has no name", i)
+		}
+
+		if _, ok := permLevels[k.Permission]; !ok {
+			return nil, fmt.Errorf("API key %s has invalid permission %q, one of read, inject or admin is expected", k.Name, k.Permission)
+		}
+
+		if k.DailyQuota < 0 {
+			return nil, fmt.Errorf("API key %s has a negative daily quota", k.Name)
+		}
+
+		hash := strings.ToLower(k.KeyHash)
+		switch {
+		case k.Key != "" && hash != "":
+			return nil, fmt.Errorf("API key %s has both key and keyHash", k.Name)
+		case k.Key != "":
+			hash = hashAPIKey(k.Key)
+		case hash == "":
+			return nil, fmt.Errorf("API key %s has neither key nor keyHash", k.Name)
+		}
+
+		if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("API key %s has an invalid keyHash", k.Name)
+		}
+
+		if _, ok := ks.keys[hash]; ok {
+			return nil, fmt.Errorf("API key %s is a duplicate", k.Name)
+		}
+		ks.keys[hash] = k
+	}
+
+	return ks, nil
+}
+
+// loadKeyStore reads the API keys file, a JSON list of apiKey
+func loadKeyStore(file string) (*keyStore, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %v", err)
+	}
+
+	var keys []apiKey
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file %s: %v", file, err)
+	}
+
+	return newKeyStore(keys)
+}
+
+func (ks *keyStore) lookup(key string) (*apiKey, bool) {
+	k, ok := ks.keys[hashAPIKey(key)]
+	return k, ok
+}
+
+// useQuota counts a request of k against its daily quota, it returns the remaining requests
+// of the day, or false when the quota is used up
+func (ks *keyStore) useQuota(k *apiKey, now time.Time) (int, bool) {
+	if k.DailyQuota == 0 {
+		return -1, true
+	}
+
+	day := now.UTC().Format("2006-01-02")
+
+	ks.Lock()
+	defer ks.Unlock()
+
+	u, ok := ks.usage[k.Name]
+	if !ok || u.day != day {
+		u = &quotaUsage{day: day}
+		ks.usage[k.Name] = u
+	}
+
+	if u.count >= k.DailyQuota {
+		return 0, false
+	}
+	u.count++
+
+	return k.DailyQuota - u.count, true
+}
+
+// authExempt are paths that never require an API key, i.e, probes, monitoring and logos
+func authExempt(p string) bool {
+	return p == "/health" || p == "/ready" || p == "/metrics" || strings.HasPrefix(p, "/static/")
+}
+
+// routePermission returns the permission needed by the route of r
+func routePermission(r *http.Request) string {
+	if cr := mux.CurrentRoute(r); cr != nil {
+		tpl, err := cr.GetPathTemplate()
+		switch {
+		case err != nil:
+		case strings.HasPrefix(tpl, "/admin/"):
+			return permAdmin
+		case tpl == "/{coinType}/injectTransaction", tpl == "/subscriptions":
+			return permInject
+		}
+	}
+	return permRead
+}
+
+// middleware rejects requests without a valid API key with 401, requests the key isn't
+// allowed to make with 403 and requests over the daily quota of the key with 429
+func (ks *keyStore) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get(apiKeyHeader)
+		if header == "" {
+			http.Error(w, fmt.Sprintf("missing %s header", apiKeyHeader), http.StatusUnauthorized)
+			return
+		}
+
+		k, ok := ks.lookup(header)
+		if !ok {
+			http.Error(w, "invalid API key", http.StatusUnauthorized)
+			return
+		}
+
+		if ri := requestInfoFrom(r.Context()); ri != nil {
+			ri.setKeyName(k.Name)
+		}
+
+		if perm := routePermission(r); !k.allows(perm) {
+			http.Error(w, fmt.Sprintf("API key %s doesn't have the %s permission", k.Name, perm), http.StatusForbidden)
+			return
+		}
+
+		if coinType := mux.Vars(r)["coinType"]; coinType != "" && !k.allowsCoin(coinType) {
+			http.Error(w, fmt.Sprintf("API key %s is not allowed to access %s", k.Name, coinType), http.StatusForbidden)
+			return
+		}
+
+		remaining, ok := ks.useQuota(k, time.Now())
+		if !ok {
+			http.Error(w, fmt.Sprintf("daily quota of API key %s is used up", k.Name), http.StatusTooManyRequests)
+			return
+		}
+		if remaining >= 0 {
+			w.Header().Set("X-Quota-Remaining", strconv.Itoa(remaining))
+		}
+
+		// routes taking coins in the body, i.e, /balances, check them against the key
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, k)))
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestKeyStore(t *testing.T) {
+	ks, err := newKeyStore([]apiKey{
+		{Name: "wallet", Key: "k1", Permission: permInject, Coins: []string{"skycoin"}, DailyQuota: 2},
+		{Name: "explorer", KeyHash: hashAPIKey("k2"), Permission: permRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, ok := ks.lookup("k1")
+	if !ok || w.Name != "wallet" {
+		t.Fatal("k1 should be found")
+	}
+	if !w.allows(permRead) || !w.allows(permInject) || w.allows(permAdmin) {
+		t.Error("unexpected permissions of wallet")
+	}
+	if !w.allowsCoin("skycoin") || w.allowsCoin("mzcoin") {
+		t.Error("unexpected coins of wallet")
+	}
+
+	e, ok := ks.lookup("k2")
+	if !ok || e.allows(permInject) || !e.allowsCoin("mzcoin") {
+		t.Error("explorer should be read only on all coins")
+	}
+
+	if _, ok := ks.lookup("k3"); ok {
+		t.Error("k3 should not be found")
+	}
+
+	now := time.Date(2018, 6, 1, 23, 0, 0, 0, time.UTC)
+	if n, ok := ks.useQuota(w, now); !ok || n != 1 {
+		t.Fatalf("expected 1 remaining request, got %d %v", n, ok)
+	}
+	if n, ok := ks.useQuota(w, now); !ok || n != 0 {
+		t.Fatalf("expected 0 remaining requests, got %d %v", n, ok)
+	}
+	if _, ok := ks.useQuota(w, now); ok {
+		t.Fatal("quota should be used up")
+	}
+	if _, ok := ks.useQuota(w, now.Add(2*time.Hour)); !ok {
+		t.Fatal("quota should be reset the next day")
+	}
+	if _, ok := ks.useQuota(e, now); !ok {
+		t.Fatal("explorer has no quota")
+	}
+}
+
+func TestNewKeyStoreInvalid(t *testing.T) {
+	for _, keys := range [][]apiKey{
+		{{Key: "k", Permission: permRead}},
+		{{Name: "a", Key: "k", Permission: "write"}},
+		{{Name: "a", Permission: permRead}},
+		{{Name: "a", Key: "k", KeyHash: hashAPIKey("k"), Permission: permRead}},
+		{{Name: "a", KeyHash: "abc", Permission: permRead}},
+		{{Name: "a", Key: "k", Permission: permRead}, {Name: "b", Key: "k", Permission: permRead}},
+	} {
+		if _, err := newKeyStore(keys); err == nil {
+			t.Errorf("%+v should be invalid", keys)
+		}
+	}
+}
+
+func TestRoutePermission(t *testing.T) {
+	var perm string
+	h := func(w http.ResponseWriter, r *http.Request) { perm = routePermission(r) }
+
+	r := mux.NewRouter()
+	r.HandleFunc("/subscriptions", h).Methods("POST", "DELETE")
+	r.HandleFunc("/{coinType}/injectTransaction", h).Methods("POST")
+	r.HandleFunc("/{coinType}/getBalance", h)
+	r.HandleFunc("/admin/coins", h)
+
+	for _, tc := range []struct {
+		method, path, perm string
+	}{
+		{"POST", "/subscriptions", permInject},
+		{"DELETE", "/subscriptions?token=t1", permInject},
+		{"POST", "/skycoin/injectTransaction", permInject},
+		{"GET", "/skycoin/getBalance?addrs=a", permRead},
+		{"GET", "/admin/coins", permAdmin},
+	} {
+		perm = ""
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tc.method, tc.path, nil))
+		if perm != tc.perm {
+			t.Errorf("%s %s should need the %s permission, got %q", tc.method, tc.path, tc.perm, perm)
+		}
+	}
+}
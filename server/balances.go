@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// coinBalance is the result of one coin of /balances, either its balance or why it couldn't be fetched
+type coinBalance struct {
+	Balance json.RawMessage `json:"balance,omitempty"`
+	Error   string          `json:"error,omitempty"`
+
+	// the node of the coin is incompatible, like the X-Superwallet-Node-Incompatible header of single coin routes
+	NodeIncompatible bool `json:"nodeIncompatible,omitempty"`
+}
+
+// getBalances fetches the balances of many coins concurrently, each node gets at most timeout to answer.
+// Coins fail independently, their errors are part of the result
+func getBalances(ctx context.Context, req map[string][]string, fiat string, timeout time.Duration) map[string]coinBalance {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ret := make(map[string]coinBalance, len(req))
+
+	for coinType, addrs := range req {
+		wg.Add(1)
+		go func(coinType string, addrs []string) {
+			defer wg.Done()
+
+			cb := getCoinBalance(ctx, coinType, addrs, fiat, timeout)
+
+			mu.Lock()
+			ret[coinType] = cb
+			mu.Unlock()
+		}(coinType, addrs)
+	}
+
+	wg.Wait()
+	return ret
+}
+
+// getCoinBalance applies to one coin the checks the middlewares do for single coin routes,
+// the API key allow-list, node compatibility and maintenance, then gets its balance
+func getCoinBalance(ctx context.Context, coinType string, addrs []string, fiat string, timeout time.Duration) coinBalance {
+	fail := func(format string, args ...interface{}) coinBalance {
+		return coinBalance{Error: fmt.Sprintf(format, args...)}
+	}
+
+	if !isCoinTypeSupported(coinType) {
+		return fail("%s is not supported", coinType)
+	}
+
+	if k, ok := requestAPIKey(ctx); ok && !k.allowsCoin(coinType) {
+		return fail("API key %s is not allowed to access %s", k.Name, coinType)
+	}
+
+	incompatible, err := checkNodeCompatible(coinType)
+	if err != nil {
+		return fail("%s", err)
+	}
+
+	if cm, _ := coins.get(coinType); cm.Maintenance {
+		return fail("%s is under maintenance, please try again later", coinType)
+	}
+
+	addrs = normalizeAddrs(strings.Join(addrs, ","))
+	if len(addrs) == 0 {
+		return fail("missing addrs")
+	}
+
+	cb := coinBalance{NodeIncompatible: incompatible}
+	cb.Balance, err = getBalanceWithTimeout(ctx, coinType, addrs, fiat, timeout)
+	if err != nil {
+		cb.Balance, cb.Error = nil, err.Error()
+	}
+	return cb
+}
+
+func getBalanceWithTimeout(ctx context.Context, coinType string, addrs []string, fiat string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		bytes []byte
+		err   error
+	}
+
+	// the node client can't be cancelled, a slow node finishes in the background and fills the cache
+	c := make(chan result, 1)
+	go func() {
+		bytes, err := getBalance(ctx, coinType, addrs)
+		c <- result{bytes, err}
+	}()
+
+	var res result
+	select {
+	case res = <-c:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%s node didn't answer within %s", coinType, timeout)
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	if fiat == "" {
+		return res.bytes, nil
+	}
+
+	bytes, _, err := withFiatBalance(coinType, fiat, res.bytes)
+	return bytes, err
+}
+
+// balancesHandler returns the balances of addresses of many coins at once, the body being
+// {"skycoin": ["addr1", "addr2"], "mzcoin": ["addr3"]}, the response is keyed by coin too, e.g,
+// {"skycoin": {"balance": {...}}, "mzcoin": {"error": "..."}}. The fiat parameter works like
+// the one of getBalance
+func balancesHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %s", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var req map[string][]string
+	if err := json.Unmarshal(b, &req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(req) == 0 {
+		http.Error(w, "no coins", http.StatusBadRequest)
+		return
+	}
+
+	if n := len(coins.all()); len(req) > n {
+		http.Error(w, fmt.Sprintf("too many coins: %d, only %d are configured", len(req), n), http.StatusBadRequest)
+		return
+	}
+
+	for coinType, addrs := range req {
+		if cfg.MaxAddrs > 0 && len(addrs) > cfg.MaxAddrs {
+			http.Error(w, fmt.Sprintf("too many addresses for %s: %d, at most %d are allowed", coinType, len(addrs), cfg.MaxAddrs), http.StatusBadRequest)
+			return
+		}
+	}
+
+	fiat := r.URL.Query().Get("fiat")
+
+	bytes, err := json.MarshalIndent(getBalances(r.Context(), req, fiat, cfg.BalanceTimeout), "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal balances: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+)
+
+func TestBalancesHandler(t *testing.T) {
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"confirmed": {"coins": 1000000, "hours": 1}, "predicted": {"coins": 1000000, "hours": 1}}`))
+	}))
+	defer fast.Close()
+
+	hang := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer slow.Close()
+	defer close(hang)
+
+	port := func(s *httptest.Server) string {
+		u, _ := url.Parse(s.URL)
+		return u.Port()
+	}
+
+	defer func(c *coinRegistry, sc serverConfig, rc *responseCache, bw *blockWatcher) {
+		coins, cfg, respCache, watcher = c, sc, rc, bw
+	}(coins, cfg, respCache, watcher)
+	coins = &coinRegistry{list: skywallet.CoinMetas{
+		{NameInEnglish: "skycoin", Symbol: "SKY", WebInterfacePort: port(fast)},
+		{NameInEnglish: "mzcoin", Symbol: "MZC", WebInterfacePort: port(slow)},
+		{NameInEnglish: "shellcoin", Symbol: "SC2", WebInterfacePort: port(fast)},
+		{NameInEnglish: "suncoin", Symbol: "SUN", Disabled: true},
+		{NameInEnglish: "aynrandcoin", Symbol: "ARC", WebInterfacePort: port(fast), Maintenance: true},
+	}}
+	cfg = defaultConfig()
+	cfg.NodeServer = "http://127.0.0.1"
+	cfg.BalanceTimeout = 50 * time.Millisecond
+	respCache = newResponseCache(map[string]time.Duration{cacheGetBalance: time.Minute}, 100)
+	watcher = newBlockWatcher(time.Minute)
+	watcher.nodeStatuses["shellcoin"] = nodeStatus{NodeVersion: "0.23.0", ExpectedVersion: "0.24.1"}
+
+	body := `{"skycoin": ["a", "b"], "mzcoin": ["c"], "shellcoin": [], "suncoin": ["d"], "aynrandcoin": ["e"]}`
+	w := httptest.NewRecorder()
+	balancesHandler(w, httptest.NewRequest("POST", "/balances", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp map[string]coinBalance
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if cb := resp["skycoin"]; cb.Error != "" || !strings.Contains(string(cb.Balance), "1000000") {
+		t.Fatalf("skycoin should have its balance, got %+v", cb)
+	}
+	if cb := resp["mzcoin"]; cb.Balance != nil || !strings.Contains(cb.Error, "didn't answer") {
+		t.Fatalf("the slow node should time out, got %+v", cb)
+	}
+	if cb := resp["shellcoin"]; cb.Error != "missing addrs" {
+		t.Fatalf("coins without addresses should fail, got %+v", cb)
+	}
+	if cb := resp["aynrandcoin"]; !strings.Contains(cb.Error, "maintenance") {
+		t.Fatalf("coins under maintenance should fail, got %+v", cb)
+	}
+	if cb := resp["suncoin"]; cb.Error != "suncoin is not supported" {
+		t.Fatalf("disabled coins should fail, got %+v", cb)
+	}
+
+	// incompatible nodes are refused like in nodeCompatibilityMiddleware
+	cfg.RefuseIncompatibleNodes = true
+	resp = getBalances(context.Background(), map[string][]string{"shellcoin": {"a"}}, "", time.Second)
+	if cb := resp["shellcoin"]; !strings.Contains(cb.Error, "not compatible") {
+		t.Fatalf("incompatible nodes should be refused, got %+v", cb)
+	}
+
+	// coins are checked against the API key, like the coinType of single coin routes
+	ctx := context.WithValue(context.Background(), apiKeyKey{}, &apiKey{Name: "ios", Coins: []string{"skycoin"}})
+	resp = getBalances(ctx, map[string][]string{"skycoin": {"a"}, "aynrandcoin": {"e"}}, "", time.Second)
+	if cb := resp["skycoin"]; cb.Error != "" {
+		t.Fatalf("skycoin is allowed, got %+v", cb)
+	}
+	if cb := resp["aynrandcoin"]; cb.Error != "API key ios is not allowed to access aynrandcoin" {
+		t.Fatalf("coins not allowed by the key should fail, got %+v", cb)
+	}
+
+	for _, body := range []string{`not json`, `{}`, `{"skycoin": ["` + strings.Repeat(`a", "`, cfg.MaxAddrs) + `a"]}`} {
+		w := httptest.NewRecorder()
+		balancesHandler(w, httptest.NewRequest("POST", "/balances", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %.20q, got %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// names of cached endpoints, also used as keys of cache TTLs and stats
+const (
+	cacheGetBalance        = "getBalance"
+	cacheGetOutputs        = "getOutputs"
+	cacheGetSupportedCoins = "getSupportedCoins"
+)
+
+type cacheEntry struct {
+	data    []byte
+	addrs   []string
+	expires time.Time
+}
+
+// cacheStats holds hit/miss counters of one endpoint
+type cacheStats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Invalidations uint64 `json:"invalidations"`
+}
+
+// responseCache caches marshalled node responses per coin, keyed by endpoint and normalized address set.
+// Entries of a coin are dropped when its node reports a new block, and entries touching an address
+// are dropped when a transaction involving that address is injected.
+// Invalidations also bump the generation of the coin, a response read from the node before an
+// invalidation is not stored afterwards, see generation.
+// At most maxEntries are kept, when they are reached expired entries are purged and if none
+// expired, the entry expiring first is dropped
+type responseCache struct {
+	sync.Mutex
+	ttls        map[string]time.Duration
+	maxEntries  int
+	size        int                              // number of entries of all coins
+	entries     map[string]map[string]cacheEntry // coinType -> key -> entry
+	generations map[string]uint64                // coinType -> generation
+	stats       map[string]*cacheStats           // endpoint -> stats
+}
+
+func newResponseCache(ttls map[string]time.Duration, maxEntries int) *responseCache {
+	return &responseCache{
+		ttls:        ttls,
+		maxEntries:  maxEntries,
+		entries:     make(map[string]map[string]cacheEntry),
+		generations: make(map[string]uint64),
+		stats:       make(map[string]*cacheStats),
+	}
+}
+
+// normalizeAddrs splits a comma separated address list, drops empty and duplicated entries and sorts it,
+// so that the same set of addresses always maps to the same cache entry
+func normalizeAddrs(addrs string) []string {
+	seen := make(map[string]struct{})
+	var ret []string
+	for _, a := range strings.Split(addrs, ",") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		if _, ok := seen[a]; ok {
+			continue
+		}
+		seen[a] = struct{}{}
+		ret = append(ret, a)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func cacheKey(endpoint string, addrs []string) string {
+	return endpoint + "?" + strings.Join(addrs, ",")
+}
+
+func (rc *responseCache) endpointStats(endpoint string) *cacheStats {
+	s, ok := rc.stats[endpoint]
+	if !ok {
+		s = &cacheStats{}
+		rc.stats[endpoint] = s
+	}
+	return s
+}
+
+func (rc *responseCache) get(coinType, endpoint string, addrs []string) ([]byte, bool) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	s := rc.endpointStats(endpoint)
+
+	e, ok := rc.entries[coinType][cacheKey(endpoint, addrs)]
+	if !ok || time.Now().After(e.expires) {
+		s.Misses++
+		return nil, false
+	}
+
+	s.Hits++
+	return e.data, true
+}
+
+// generation returns the generation of a coin, it is read before calling the node and passed to set
+func (rc *responseCache) generation(coinType string) uint64 {
+	rc.Lock()
+	defer rc.Unlock()
+
+	return rc.generations[coinType]
+}
+
+// set stores a response, unless the coin was invalidated since gen was read, the response may be stale then
+func (rc *responseCache) set(coinType, endpoint string, addrs []string, gen uint64, data []byte) {
+	ttl := rc.ttls[endpoint]
+	if ttl <= 0 {
+		// caching is disabled for this endpoint
+		return
+	}
+
+	rc.Lock()
+	defer rc.Unlock()
+
+	if rc.generations[coinType] != gen {
+		return
+	}
+
+	if _, ok := rc.entries[coinType]; !ok {
+		rc.entries[coinType] = make(map[string]cacheEntry)
+	}
+
+	now := time.Now()
+	key := cacheKey(endpoint, addrs)
+	if _, ok := rc.entries[coinType][key]; !ok {
+		if rc.size >= rc.maxEntries {
+			rc.purge(now)
+		}
+		rc.size++
+	}
+
+	rc.entries[coinType][key] = cacheEntry{
+		data:    data,
+		addrs:   addrs,
+		expires: now.Add(ttl),
+	}
+}
+
+// purge drops expired entries, or the entry expiring first if none expired, the caller holds the lock
+func (rc *responseCache) purge(now time.Time) {
+	var firstCoin, firstKey string
+	var first time.Time
+	for coinType, entries := range rc.entries {
+		for key, e := range entries {
+			if now.After(e.expires) {
+				rc.drop(coinType, key)
+				continue
+			}
+			if firstKey == "" || e.expires.Before(first) {
+				firstCoin, firstKey, first = coinType, key, e.expires
+			}
+		}
+	}
+
+	if rc.size >= rc.maxEntries && firstKey != "" {
+		rc.drop(firstCoin, firstKey)
+	}
+}
+
+// drop removes an entry, the caller holds the lock
+func (rc *responseCache) drop(coinType, key string) {
+	delete(rc.entries[coinType], key)
+	rc.size--
+}
+
+// invalidateCoin drops all entries of a coin, called when its node reports a new block
+func (rc *responseCache) invalidateCoin(coinType string) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	rc.generations[coinType]++
+	for key := range rc.entries[coinType] {
+		rc.endpointStats(key[:strings.IndexByte(key, '?')]).Invalidations++
+	}
+	rc.size -= len(rc.entries[coinType])
+	delete(rc.entries, coinType)
+}
+
+// invalidateAddrs drops entries of a coin that contain any of addrs
+func (rc *responseCache) invalidateAddrs(coinType string, addrs []string) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	rc.generations[coinType]++
+	set := make(map[string]struct{}, len(addrs))
+	for _, a := range addrs {
+		set[a] = struct{}{}
+	}
+
+	for key, e := range rc.entries[coinType] {
+		for _, a := range e.addrs {
+			if _, ok := set[a]; ok {
+				rc.endpointStats(key[:strings.IndexByte(key, '?')]).Invalidations++
+				rc.drop(coinType, key)
+				break
+			}
+		}
+	}
+}
+
+// snapshot returns a copy of the per endpoint stats
+func (rc *responseCache) snapshot() map[string]cacheStats {
+	rc.Lock()
+	defer rc.Unlock()
+
+	ret := make(map[string]cacheStats, len(rc.stats))
+	for k, v := range rc.stats {
+		ret[k] = *v
+	}
+	return ret
+}
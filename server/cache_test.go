@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeAddrs(t *testing.T) {
+	got := normalizeAddrs(" b,a,,b, c")
+	expect := []string{"a", "b", "c"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expected %v, got %v", expect, got)
+	}
+}
+
+func TestResponseCacheInvalidation(t *testing.T) {
+	rc := newResponseCache(map[string]time.Duration{
+		cacheGetBalance: time.Minute,
+	}, 100)
+
+	ab := normalizeAddrs("a,b")
+	cd := normalizeAddrs("c,d")
+
+	rc.set("skycoin", cacheGetBalance, ab, 0, []byte("ab"))
+	rc.set("skycoin", cacheGetBalance, cd, 0, []byte("cd"))
+	rc.set("mzcoin", cacheGetBalance, ab, 0, []byte("ab"))
+
+	// getOutputs has no TTL, so it is never cached
+	rc.set("skycoin", cacheGetOutputs, ab, 0, []byte("ab"))
+	if _, ok := rc.get("skycoin", cacheGetOutputs, ab); ok {
+		t.Fatal("getOutputs should not be cached")
+	}
+
+	if d, ok := rc.get("skycoin", cacheGetBalance, normalizeAddrs("b,a")); !ok || string(d) != "ab" {
+		t.Fatal("expected a hit for the same address set")
+	}
+
+	rc.invalidateAddrs("skycoin", []string{"b"})
+	if _, ok := rc.get("skycoin", cacheGetBalance, ab); ok {
+		t.Fatal("entry containing b should be invalidated")
+	}
+	if _, ok := rc.get("skycoin", cacheGetBalance, cd); !ok {
+		t.Fatal("entry without b should be kept")
+	}
+	if _, ok := rc.get("mzcoin", cacheGetBalance, ab); !ok {
+		t.Fatal("entries of other coins should be kept")
+	}
+
+	rc.invalidateCoin("skycoin")
+	if _, ok := rc.get("skycoin", cacheGetBalance, cd); ok {
+		t.Fatal("all skycoin entries should be invalidated")
+	}
+
+	s := rc.snapshot()[cacheGetBalance]
+	if s.Hits != 3 || s.Misses != 2 || s.Invalidations != 2 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestResponseCacheGeneration(t *testing.T) {
+	rc := newResponseCache(map[string]time.Duration{
+		cacheGetBalance: time.Minute,
+	}, 100)
+
+	ab := normalizeAddrs("a,b")
+
+	// a block is seen while the node is called, the balance read before it is not cached
+	gen := rc.generation("skycoin")
+	rc.invalidateCoin("skycoin")
+	rc.set("skycoin", cacheGetBalance, ab, gen, []byte("stale"))
+	if _, ok := rc.get("skycoin", cacheGetBalance, ab); ok {
+		t.Fatal("a response read before an invalidation should not be cached")
+	}
+
+	gen = rc.generation("skycoin")
+	rc.invalidateAddrs("skycoin", []string{"c"})
+	rc.set("skycoin", cacheGetBalance, ab, gen, []byte("stale"))
+	if _, ok := rc.get("skycoin", cacheGetBalance, ab); ok {
+		t.Fatal("a response read before an address invalidation should not be cached")
+	}
+
+	gen = rc.generation("skycoin")
+	rc.invalidateCoin("mzcoin")
+	rc.set("skycoin", cacheGetBalance, ab, gen, []byte("ab"))
+	if d, ok := rc.get("skycoin", cacheGetBalance, ab); !ok || string(d) != "ab" {
+		t.Fatal("invalidations of other coins should not drop the response")
+	}
+}
+
+func TestResponseCacheMaxEntries(t *testing.T) {
+	rc := newResponseCache(map[string]time.Duration{
+		cacheGetBalance: time.Minute,
+	}, 2)
+
+	a, b, c := normalizeAddrs("a"), normalizeAddrs("b"), normalizeAddrs("c")
+
+	rc.set("skycoin", cacheGetBalance, a, 0, []byte("a"))
+	rc.set("mzcoin", cacheGetBalance, b, 0, []byte("b"))
+	rc.set("mzcoin", cacheGetBalance, b, 0, []byte("b"))
+	if rc.size != 2 {
+		t.Fatalf("replacing an entry should not count twice, size is %d", rc.size)
+	}
+
+	// no entry expired, the one expiring first makes room
+	rc.set("skycoin", cacheGetBalance, c, 0, []byte("c"))
+	if _, ok := rc.get("skycoin", cacheGetBalance, a); ok {
+		t.Fatal("the entry expiring first should be dropped")
+	}
+	if _, ok := rc.get("mzcoin", cacheGetBalance, b); !ok {
+		t.Fatal("other entries should be kept")
+	}
+
+	// expired entries are purged before dropping live ones
+	e := rc.entries["mzcoin"][cacheKey(cacheGetBalance, b)]
+	e.expires = time.Now().Add(-time.Second)
+	rc.entries["mzcoin"][cacheKey(cacheGetBalance, b)] = e
+	rc.set("skycoin", cacheGetBalance, a, 0, []byte("a"))
+	if _, ok := rc.get("skycoin", cacheGetBalance, c); !ok {
+		t.Fatal("live entries should be kept while expired ones can be purged")
+	}
+	if _, ok := rc.entries["mzcoin"][cacheKey(cacheGetBalance, b)]; ok || rc.size != 2 {
+		t.Fatalf("expired entry should be purged, size is %d", rc.size)
+	}
+
+	rc.invalidateCoin("skycoin")
+	if rc.size != 0 {
+		t.Fatalf("invalidated entries should not count, size is %d", rc.size)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+)
+
+// coinRegistry holds the coins of the coins config file, which can be changed at runtime by the admin API.
+// The list is replaced, never modified in place, so readers can use it without copying
+type coinRegistry struct {
+	file string
+
+	updates sync.Mutex // serializes updates, each of them rewrites the file
+
+	sync.RWMutex
+	list skywallet.CoinMetas // in config file order
+}
+
+// coins are the coins in use, loaded once at startup by loadCoinsConfig
+var coins = &coinRegistry{}
+
+func loadCoinRegistry(file string) (*coinRegistry, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load coin configuration file %s", err)
+	}
+
+	cms := skywallet.CoinMetas{}
+	if err := json.Unmarshal(b, &cms); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal configuration data %s", err)
+	}
+
+	seen := make(map[string]bool, len(cms))
+	for _, cm := range cms {
+		if seen[cm.NameInEnglish] {
+			return nil, fmt.Errorf("coin %s is configured twice", cm.NameInEnglish)
+		}
+		seen[cm.NameInEnglish] = true
+	}
+
+	return &coinRegistry{file: file, list: cms}, nil
+}
+
+// all returns every coin, including disabled ones
+func (cr *coinRegistry) all() skywallet.CoinMetas {
+	cr.RLock()
+	defer cr.RUnlock()
+	return cr.list
+}
+
+// get returns a coin by its english name, disabled or not
+func (cr *coinRegistry) get(coinType string) (skywallet.CoinMeta, bool) {
+	for _, cm := range cr.all() {
+		if cm.NameInEnglish == coinType {
+			return cm, true
+		}
+	}
+	return skywallet.CoinMeta{}, false
+}
+
+// enabled returns the coins being served, keyed by english name
+func (cr *coinRegistry) enabled() map[string]skywallet.CoinMeta {
+	list := cr.all()
+	ret := make(map[string]skywallet.CoinMeta, len(list))
+	for _, cm := range list {
+		if !cm.Disabled {
+			ret[cm.NameInEnglish] = cm
+		}
+	}
+	return ret
+}
+
+// update applies f to a copy of the coin list, writes the result to the config file and
+// only then makes it visible, so that the file and the served coins never disagree
+func (cr *coinRegistry) update(f func(skywallet.CoinMetas) (skywallet.CoinMetas, error)) error {
+	cr.updates.Lock()
+	defer cr.updates.Unlock()
+
+	list := append(skywallet.CoinMetas(nil), cr.all()...)
+	list, err := f(list)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(list, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(cr.file, b, 0644); err != nil {
+		return fmt.Errorf("failed to write coins config file: %v", err)
+	}
+
+	cr.Lock()
+	cr.list = list
+	cr.Unlock()
+
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to file and renames it,
+// readers see either the old or the new content, never a partial write
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+)
+
+func TestCoinRegistryUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "superwallet-coins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "coins.config.json")
+	err = ioutil.WriteFile(file, []byte(`[{"nameInEnglish": "skycoin", "symbol": "SKY", "webInterfacePort": "6420"}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cr, err := loadCoinRegistry(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cr.update(func(list skywallet.CoinMetas) (skywallet.CoinMetas, error) {
+		return append(list, skywallet.CoinMeta{NameInEnglish: "mzcoin", Symbol: "MZC", WebInterfacePort: "7420", Disabled: true}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cr.get("mzcoin"); !ok {
+		t.Fatal("mzcoin should be added")
+	}
+	if _, ok := cr.enabled()["mzcoin"]; ok {
+		t.Fatal("disabled coins should not be enabled")
+	}
+
+	// the file is rewritten, and nothing else is left in the directory
+	reloaded, err := loadCoinRegistry(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := reloaded.all(); len(l) != 2 || l[1].NameInEnglish != "mzcoin" || !l[1].Disabled {
+		t.Fatalf("unexpected coins in file %+v", l)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("expected only the config file, got %d files", len(files))
+	}
+
+	// failed updates change nothing
+	err = cr.update(func(list skywallet.CoinMetas) (skywallet.CoinMetas, error) {
+		list[0].Symbol = "XXX"
+		return nil, errors.New("failed")
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if cm, _ := cr.get("skycoin"); cm.Symbol != "SKY" {
+		t.Fatalf("failed update should not change coins, got symbol %s", cm.Symbol)
+	}
+}
+
+func TestValidateCoinMeta(t *testing.T) {
+	valid := skywallet.CoinMeta{NameInEnglish: "skycoin", Symbol: "SKY", WebInterfacePort: "6420", NodeVersion: ">=0.24.0 <0.25.0"}
+	if err := validateCoinMeta(valid); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []func(cm *skywallet.CoinMeta){
+		func(cm *skywallet.CoinMeta) { cm.NameInEnglish = "Sky Coin" },
+		func(cm *skywallet.CoinMeta) { cm.Symbol = " " },
+		func(cm *skywallet.CoinMeta) { cm.Symbol = "../../x" },
+		func(cm *skywallet.CoinMeta) { cm.WebInterfacePort = "70000" },
+		func(cm *skywallet.CoinMeta) { cm.NodeVersion = "latest" },
+	} {
+		cm := valid
+		f(&cm)
+		if err := validateCoinMeta(cm); err == nil {
+			t.Errorf("%+v should be invalid", cm)
+		}
+	}
+}
+
+func TestSymbolTaken(t *testing.T) {
+	list := skywallet.CoinMetas{
+		{NameInEnglish: "skycoin", Symbol: "SKY"},
+		{NameInEnglish: "mzcoin", Symbol: "MZC"},
+	}
+
+	if symbolTaken(list, skywallet.CoinMeta{NameInEnglish: "skycoin", Symbol: "SKY"}) {
+		t.Fatal("a coin keeping its symbol doesn't collide with itself")
+	}
+	if !symbolTaken(list, skywallet.CoinMeta{NameInEnglish: "newcoin", Symbol: "sky"}) {
+		t.Fatal("symbols differing by case name the same logo file")
+	}
+	if symbolTaken(list, skywallet.CoinMeta{NameInEnglish: "newcoin", Symbol: "NEW"}) {
+		t.Fatal("NEW is not used")
+	}
+}
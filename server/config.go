@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+	log "github.com/sirupsen/logrus"
+)
+
+// envPrefix is the prefix of environment variables, e.g, -node-server can be set with SUPERWALLET_NODE_SERVER
+const envPrefix = "SUPERWALLET_"
+
+// secretFlags are flags whose whole value is a credential, e.g, webhook URLs embed a token in their path,
+// print-config hides them. Credentials of URLs in other flags, i.e, userinfo and query, are hidden too
+var secretFlags = map[string]bool{
+	"notify-webhook-url": true,
+}
+
+// urlCredentialsRe matches the userinfo and the query of URLs
+var urlCredentialsRe = regexp.MustCompile(`://[^/@,\s]+@|\?[^,\s]*`)
+
+// serverConfig holds all settings of the server. Each setting can be given, in increasing order of precedence,
+// in the server config file, as an environment variable or as a command line flag
+type serverConfig struct {
+	Host            string
+	Port            string
+	NodeServer      string
+	CoinsConfigFile string
+	StaticDir       string
+	StaticMaxAge    time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	LogFormat       string
+	LogLevel        string
+
+	BalanceCacheTTL   time.Duration
+	OutputsCacheTTL   time.Duration
+	CoinsCacheTTL     time.Duration
+	MaxCacheEntries   int
+	BlockPollInterval time.Duration
+
+	PriceSources  string
+	PriceSymbols  string
+	PriceFiats    string
+	PriceInterval time.Duration
+	PriceMaxAge   time.Duration
+
+	MaxScanBlocks    uint64
+	MaxStreams       int
+	PoolPollInterval time.Duration
+
+	WebhooksFile       string
+	WebhookMaxAttempts int
+	WebhookRetryDelay  time.Duration
+
+	TxCheckInterval time.Duration
+	TxTrackTTL      time.Duration
+	MaxRebroadcasts int
+
+	VerifyTransactions bool
+	IdempotencyTTL     time.Duration
+
+	BalanceTimeout time.Duration
+
+	SubscriptionsFile    string
+	MaxSubscriptions     int
+	MaxSubscriptionAddrs int
+	NotifyTestPlatforms  bool
+	NotifyWebhookURL     string
+	FCMCredentialsFile   string
+	APNsKeyFile          string
+	APNsKeyID            string
+	APNsTeamID           string
+	APNsTopic            string
+	APNsSandbox          bool
+
+	RefuseIncompatibleNodes bool
+	MinClientVersion        string
+	RejectLegacyClients     bool
+
+	RateLimit       float64
+	RateBurst       int
+	RouteRateLimits string
+	MaxAddrs        int
+	MaxBodyBytes    int64
+	MaxLogoBytes    int64
+	TrustProxy      bool
+	APIKeysFile     string
+
+	TLSCertFile  string
+	TLSKeyFile   string
+	ACMEDomains  string
+	ACMECacheDir string
+	ACMEEmail    string
+	RedirectPort string
+}
+
+// cfg is the configuration in use, it is loaded once at startup
+var cfg = defaultConfig()
+
+func defaultConfig() serverConfig {
+	return serverConfig{
+		Host:            "0.0.0.0",
+		Port:            "6789",
+		NodeServer:      "http://localhost",
+		CoinsConfigFile: "coins.config.json",
+		StaticDir:       "static",
+		StaticMaxAge:    24 * time.Hour,
+		// Good practice to set timeouts to avoid Slowloris attacks.
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+
+		ShutdownTimeout: 30 * time.Second,
+		LogFormat:       "json",
+		LogLevel:        "info",
+
+		BalanceCacheTTL:   10 * time.Second,
+		OutputsCacheTTL:   10 * time.Second,
+		CoinsCacheTTL:     5 * time.Minute,
+		MaxCacheEntries:   100000,
+		BlockPollInterval: 10 * time.Second,
+
+		PriceSources:  "cryptocompare",
+		PriceSymbols:  "SKY=cryptocompare:SKY",
+		PriceFiats:    "CNY,USD",
+		PriceInterval: 5 * time.Minute,
+		PriceMaxAge:   time.Hour,
+
+		MaxScanBlocks:    100,
+		MaxStreams:       1000,
+		PoolPollInterval: 5 * time.Second,
+
+		WebhookMaxAttempts: 10,
+		WebhookRetryDelay:  30 * time.Second,
+
+		TxCheckInterval: 30 * time.Second,
+		TxTrackTTL:      24 * time.Hour,
+		MaxRebroadcasts: 5,
+
+		VerifyTransactions: true,
+		IdempotencyTTL:     24 * time.Hour,
+
+		BalanceTimeout: 10 * time.Second,
+
+		MaxSubscriptions:     100000,
+		MaxSubscriptionAddrs: 1000,
+
+		RateLimit:       10,
+		RateBurst:       20,
+		RouteRateLimits: "/{coinType}/injectTransaction=1:5",
+		MaxAddrs:        100,
+		MaxBodyBytes:    64 * 1024,
+		MaxLogoBytes:    256 * 1024,
+
+		ACMECacheDir: "certs",
+	}
+}
+
+// flagSet registers every setting of c as a flag
+func (c *serverConfig) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+
+	fs.StringVar(&c.Host, "host", c.Host, "interface the server listens on")
+	fs.StringVar(&c.Port, "port", c.Port, "port the server listens on")
+	fs.StringVar(&c.NodeServer, "node-server", c.NodeServer, "URL of the host running the coin nodes, without port")
+	fs.StringVar(&c.CoinsConfigFile, "coins-config", c.CoinsConfigFile, "coins configuration file")
+	fs.StringVar(&c.StaticDir, "static-dir", c.StaticDir, "directory of the coin logos")
+	fs.DurationVar(&c.StaticMaxAge, "static-max-age", c.StaticMaxAge, "how long clients may cache logos")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "maximum duration for reading a request")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "maximum duration for writing a response")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "how long idle keep-alive connections are kept open")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "how long in-flight requests are given to complete on SIGINT or SIGTERM")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "log format, json or text")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "log level: debug, info, warning, error")
+
+	fs.DurationVar(&c.BalanceCacheTTL, "balance-cache-ttl", c.BalanceCacheTTL, "how long getBalance responses are cached, 0 disables caching")
+	fs.DurationVar(&c.OutputsCacheTTL, "outputs-cache-ttl", c.OutputsCacheTTL, "how long getOutputs responses are cached, 0 disables caching")
+	fs.DurationVar(&c.CoinsCacheTTL, "coins-cache-ttl", c.CoinsCacheTTL, "how long the getSupportedCoins response is cached, 0 disables caching")
+	fs.IntVar(&c.MaxCacheEntries, "max-cache-entries", c.MaxCacheEntries, "maximum number of cached responses of all coins, the ones expiring first are dropped when it is reached")
+	fs.DurationVar(&c.BlockPollInterval, "block-poll-interval", c.BlockPollInterval, "how often nodes are polled for new blocks")
+
+	fs.StringVar(&c.PriceSources, "price-sources", c.PriceSources, "comma separated price sources, tried in order for each coin: cryptocompare, cryptocompare=<url> or file=<path>")
+	fs.StringVar(&c.PriceSymbols, "price-symbols", c.PriceSymbols, "comma separated coins fetched from a market data source, in the form SYMBOL=source:TICKER, e.g, SKY=cryptocompare:SKY. cryptocompare only gets these coins")
+	fs.StringVar(&c.PriceFiats, "price-fiats", c.PriceFiats, "comma separated fiat currencies prices are fetched in")
+	fs.DurationVar(&c.PriceInterval, "price-interval", c.PriceInterval, "how often prices are fetched")
+	fs.DurationVar(&c.PriceMaxAge, "price-max-age", c.PriceMaxAge, "prices that couldn't be fetched for this long are no longer served")
+
+	fs.Uint64Var(&c.MaxScanBlocks, "max-scan-blocks", c.MaxScanBlocks, "maximum number of blocks scanned for payments at once, i.e, after a node outage")
+	fs.IntVar(&c.MaxStreams, "max-streams", c.MaxStreams, "maximum number of open /{coinType}/stream connections")
+	fs.DurationVar(&c.PoolPollInterval, "pool-poll-interval", c.PoolPollInterval, "how often unconfirmed transactions are polled for coins with open streams")
+	fs.StringVar(&c.WebhooksFile, "webhooks-file", c.WebhooksFile, "file webhooks registered with the admin API and their deliveries are saved to, empty keeps them in memory only")
+	fs.IntVar(&c.WebhookMaxAttempts, "webhook-max-attempts", c.WebhookMaxAttempts, "attempts after which a webhook delivery is moved to the dead-letter list")
+	fs.DurationVar(&c.WebhookRetryDelay, "webhook-retry-delay", c.WebhookRetryDelay, "delay before the first retry of a failed webhook delivery, doubled with each attempt")
+	fs.DurationVar(&c.TxCheckInterval, "tx-check-interval", c.TxCheckInterval, "how often the status of injected transactions is checked")
+	fs.DurationVar(&c.TxTrackTTL, "tx-track-ttl", c.TxTrackTTL, "how long injected transactions are tracked")
+	fs.IntVar(&c.MaxRebroadcasts, "max-rebroadcasts", c.MaxRebroadcasts, "times a transaction dropped from the pool is rebroadcast before it is reported as failed")
+	fs.BoolVar(&c.VerifyTransactions, "verify-transactions", c.VerifyTransactions, "check signatures, inputs, coin hours and dust of transactions before they are injected")
+	fs.DurationVar(&c.IdempotencyTTL, "idempotency-ttl", c.IdempotencyTTL, "how long results of injections with an Idempotency-Key header are kept")
+	fs.DurationVar(&c.BalanceTimeout, "balance-timeout", c.BalanceTimeout, "how long each node gets to answer a /balances request")
+	fs.StringVar(&c.SubscriptionsFile, "subscriptions-file", c.SubscriptionsFile, "file push notification subscriptions are saved to, empty keeps them in memory only")
+	fs.IntVar(&c.MaxSubscriptions, "max-subscriptions", c.MaxSubscriptions, "maximum number of devices subscribed to push notifications")
+	fs.IntVar(&c.MaxSubscriptionAddrs, "max-subscription-addrs", c.MaxSubscriptionAddrs, "maximum number of addresses a device is subscribed to, all coins together")
+	fs.BoolVar(&c.NotifyTestPlatforms, "notify-test-platforms", c.NotifyTestPlatforms, "enable the log and webhook push notification platforms, for testing only")
+	fs.StringVar(&c.NotifyWebhookURL, "notify-webhook-url", c.NotifyWebhookURL, "URL notifications of the webhook platform are posted to")
+	fs.StringVar(&c.FCMCredentialsFile, "fcm-credentials", c.FCMCredentialsFile, "Firebase service account key (JSON) file, enables the fcm platform")
+	fs.StringVar(&c.APNsKeyFile, "apns-key", c.APNsKeyFile, "APNs authentication key (.p8) file, enables the apns platform")
+	fs.StringVar(&c.APNsKeyID, "apns-key-id", c.APNsKeyID, "ID of the APNs authentication key")
+	fs.StringVar(&c.APNsTeamID, "apns-team-id", c.APNsTeamID, "Apple developer team ID")
+	fs.StringVar(&c.APNsTopic, "apns-topic", c.APNsTopic, "bundle ID of the app")
+	fs.BoolVar(&c.APNsSandbox, "apns-sandbox", c.APNsSandbox, "use the APNs development environment")
+
+	fs.BoolVar(&c.RefuseIncompatibleNodes, "refuse-incompatible-nodes", c.RefuseIncompatibleNodes, "refuse requests for coins whose node version doesn't match the configured nodeVersion, instead of only flagging them")
+	fs.StringVar(&c.MinClientVersion, "min-client-version", c.MinClientVersion, "reject clients whose API version is lower than this, empty accepts all clients")
+	fs.BoolVar(&c.RejectLegacyClients, "reject-legacy-clients", c.RejectLegacyClients, "reject clients that don't send their API version")
+
+	fs.Float64Var(&c.RateLimit, "rate-limit", c.RateLimit, "requests per second allowed per client and route, 0 disables rate limiting")
+	fs.IntVar(&c.RateBurst, "rate-burst", c.RateBurst, "burst size of the per client rate limiter")
+	fs.StringVar(&c.RouteRateLimits, "route-rate-limits", c.RouteRateLimits, "comma separated per route limits overriding -rate-limit, in the form route=rate:burst")
+	fs.IntVar(&c.MaxAddrs, "max-addrs", c.MaxAddrs, "maximum number of addresses in an addrs query, 0 means no limit")
+	fs.Int64Var(&c.MaxBodyBytes, "max-body-bytes", c.MaxBodyBytes, "maximum size of an injectTransaction request body")
+	fs.Int64Var(&c.MaxLogoBytes, "max-logo-bytes", c.MaxLogoBytes, "maximum size of a logo uploaded with the admin API")
+	fs.BoolVar(&c.TrustProxy, "trust-proxy", c.TrustProxy, "use the X-Forwarded-For header as client IP, only enable it behind a reverse proxy")
+	fs.StringVar(&c.APIKeysFile, "api-keys", c.APIKeysFile, "API keys file, a JSON list of keys with their permission, coins and daily quota, enables API key authentication and the admin API")
+
+	fs.StringVar(&c.TLSCertFile, "tls-cert", c.TLSCertFile, "certificate file, enables HTTPS together with -tls-key")
+	fs.StringVar(&c.TLSKeyFile, "tls-key", c.TLSKeyFile, "private key file of -tls-cert")
+	fs.StringVar(&c.ACMEDomains, "acme-domains", c.ACMEDomains, "comma separated domains to get certificates for from Let's Encrypt, e.g, superwallet.shellpay.com, enables HTTPS")
+	fs.StringVar(&c.ACMECacheDir, "acme-cache-dir", c.ACMECacheDir, "directory where certificates obtained by ACME are cached")
+	fs.StringVar(&c.ACMEEmail, "acme-email", c.ACMEEmail, "contact email of the ACME account")
+	fs.StringVar(&c.RedirectPort, "http-redirect-port", c.RedirectPort, "when HTTPS is enabled, port of a plain HTTP listener redirecting to HTTPS and answering ACME challenges, empty disables it")
+
+	return fs
+}
+
+// loadConfig builds the configuration from, in increasing order of precedence, defaults,
+// the server config file, environment variables and command line flags.
+// It returns true when the configuration should be printed instead of starting the server
+func loadConfig(args []string) (serverConfig, bool, error) {
+	c := defaultConfig()
+	fs := c.flagSet()
+
+	var configFile string
+	var printConfig bool
+	fs.StringVar(&configFile, "config", os.Getenv(envPrefix+"CONFIG"), "optional server config file, a JSON object keyed by flag names, e.g, {\"port\": \"6789\"}")
+	fs.BoolVar(&printConfig, "print-config", false, "print the effective configuration as JSON and exit")
+
+	if err := fs.Parse(args); err != nil {
+		return c, false, err
+	}
+
+	// flags given on the command line win, the file and environment only fill the others
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	explicit["config"] = true
+	explicit["print-config"] = true
+
+	if configFile != "" {
+		if err := applyConfigFile(fs, configFile, explicit); err != nil {
+			return c, false, err
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] {
+			return
+		}
+
+		name := envPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		if v, ok := os.LookupEnv(name); ok {
+			if e := f.Value.Set(v); e != nil {
+				err = fmt.Errorf("invalid value %q of %s: %v", v, name, e)
+			}
+		}
+	})
+	if err != nil {
+		return c, false, err
+	}
+
+	return c, printConfig, c.validate()
+}
+
+func applyConfigFile(fs *flag.FlagSet, file string, explicit map[string]bool) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read server config file: %v", err)
+	}
+
+	// keep numbers as written, e.g, 1000000 would become 1e+06 as a float64
+	values := make(map[string]interface{})
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&values); err != nil {
+		return fmt.Errorf("failed to parse server config file %s: %v", file, err)
+	}
+
+	for name, v := range values {
+		f := fs.Lookup(name)
+		if f == nil || name == "config" || name == "print-config" {
+			return fmt.Errorf("unknown setting %s in server config file %s", name, file)
+		}
+
+		if explicit[name] {
+			continue
+		}
+
+		if err := f.Value.Set(fmt.Sprint(v)); err != nil {
+			return fmt.Errorf("invalid value %v of %s in server config file %s: %v", v, name, file, err)
+		}
+	}
+
+	return nil
+}
+
+// validate checks that settings make sense together
+func (c serverConfig) validate() error {
+	for name, port := range map[string]string{"port": c.Port, "http-redirect-port": c.RedirectPort} {
+		if name == "http-redirect-port" && port == "" {
+			continue
+		}
+		if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+			return fmt.Errorf("invalid %s %q", name, port)
+		}
+	}
+
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		return fmt.Errorf("invalid log-format %q, json or text is expected", c.LogFormat)
+	}
+
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid log-level %q: %v", c.LogLevel, err)
+	}
+
+	if u, err := url.Parse(c.NodeServer); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid node server %q, a URL such as http://localhost is expected", c.NodeServer)
+	}
+
+	if _, err := os.Stat(c.CoinsConfigFile); err != nil {
+		return fmt.Errorf("coins config file: %v", err)
+	}
+
+	for name, d := range map[string]time.Duration{
+		"read-timeout":        c.ReadTimeout,
+		"write-timeout":       c.WriteTimeout,
+		"idle-timeout":        c.IdleTimeout,
+		"shutdown-timeout":    c.ShutdownTimeout,
+		"block-poll-interval": c.BlockPollInterval,
+		"price-interval":      c.PriceInterval,
+		"price-max-age":       c.PriceMaxAge,
+		"pool-poll-interval":  c.PoolPollInterval,
+		"webhook-retry-delay": c.WebhookRetryDelay,
+		"tx-check-interval":   c.TxCheckInterval,
+		"tx-track-ttl":        c.TxTrackTTL,
+		"idempotency-ttl":     c.IdempotencyTTL,
+		"balance-timeout":     c.BalanceTimeout,
+	} {
+		if d <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+
+	for name, d := range map[string]time.Duration{
+		"balance-cache-ttl": c.BalanceCacheTTL,
+		"outputs-cache-ttl": c.OutputsCacheTTL,
+		"coins-cache-ttl":   c.CoinsCacheTTL,
+		"static-max-age":    c.StaticMaxAge,
+	} {
+		if d < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+
+	if c.MaxCacheEntries <= 0 {
+		return errors.New("max-cache-entries must be positive")
+	}
+
+	if c.RateLimit < 0 {
+		return errors.New("rate-limit must not be negative")
+	}
+
+	if c.RateLimit > 0 && c.RateBurst < 1 {
+		return errors.New("rate-burst must be at least 1")
+	}
+
+	if _, err := parsePriceSources(c.PriceSources); err != nil {
+		return err
+	}
+
+	if _, err := parsePriceSymbols(c.PriceSymbols); err != nil {
+		return err
+	}
+
+	if c.PriceMaxAge <= c.PriceInterval {
+		return errors.New("price-max-age must be longer than price-interval")
+	}
+
+	if c.PriceSources != "" && len(parseCodes(c.PriceFiats)) == 0 {
+		return errors.New("price-fiats must not be empty when price-sources is set")
+	}
+
+	if c.MaxStreams <= 0 {
+		return errors.New("max-streams must be positive")
+	}
+
+	if c.WebhookMaxAttempts <= 0 {
+		return errors.New("webhook-max-attempts must be positive")
+	}
+
+	if c.MaxRebroadcasts < 0 {
+		return errors.New("max-rebroadcasts must not be negative")
+	}
+
+	if c.MaxScanBlocks == 0 {
+		return errors.New("max-scan-blocks must be positive")
+	}
+
+	if c.MaxSubscriptions <= 0 {
+		return errors.New("max-subscriptions must be positive")
+	}
+
+	if c.MaxSubscriptionAddrs <= 0 {
+		return errors.New("max-subscription-addrs must be positive")
+	}
+
+	if c.NotifyWebhookURL != "" && !c.NotifyTestPlatforms {
+		return errors.New("notify-webhook-url requires notify-test-platforms")
+	}
+
+	if c.FCMCredentialsFile != "" {
+		if _, _, err := loadFCMCredentials(c.FCMCredentialsFile); err != nil {
+			return err
+		}
+	}
+
+	if c.APNsKeyFile != "" {
+		if c.APNsKeyID == "" || c.APNsTeamID == "" || c.APNsTopic == "" {
+			return errors.New("apns-key-id, apns-team-id and apns-topic must be set together with apns-key")
+		}
+		if _, err := loadAPNsKey(c.APNsKeyFile); err != nil {
+			return err
+		}
+	}
+
+	if _, err := parseRouteLimits(c.RouteRateLimits); err != nil {
+		return err
+	}
+
+	if c.MaxAddrs < 0 {
+		return errors.New("max-addrs must not be negative")
+	}
+
+	if c.MaxBodyBytes <= 0 {
+		return errors.New("max-body-bytes must be positive")
+	}
+
+	if c.MaxLogoBytes <= 0 {
+		return errors.New("max-logo-bytes must be positive")
+	}
+
+	if c.APIKeysFile != "" {
+		if _, err := loadKeyStore(c.APIKeysFile); err != nil {
+			return err
+		}
+	}
+
+	if c.MinClientVersion != "" {
+		if _, err := semver.ParseTolerant(c.MinClientVersion); err != nil {
+			return fmt.Errorf("invalid min-client-version %q: %v", c.MinClientVersion, err)
+		}
+	}
+
+	if c.ACMEDomains != "" && (c.TLSCertFile != "" || c.TLSKeyFile != "") {
+		return errors.New("acme-domains can't be used together with tls-cert and tls-key")
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("tls-cert and tls-key must be set together")
+	}
+
+	return nil
+}
+
+// print writes the configuration to stdout in the server config file format, without its credentials
+func (c serverConfig) print() error {
+	b, err := json.MarshalIndent(c.printableValues(), "", "    ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(b))
+	return nil
+}
+
+// printableValues returns the value of each flag, with credentials hidden, see secretFlags
+func (c serverConfig) printableValues() map[string]string {
+	values := make(map[string]string)
+	c.flagSet().VisitAll(func(f *flag.Flag) {
+		v := f.Value.String()
+		switch {
+		case v == "":
+		case secretFlags[f.Name]:
+			v = "REDACTED"
+		default:
+			v = urlCredentialsRe.ReplaceAllStringFunc(v, func(m string) string {
+				if strings.HasPrefix(m, "?") {
+					return "?REDACTED"
+				}
+				return "://REDACTED@"
+			})
+		}
+		values[f.Name] = v
+	})
+	return values
+}
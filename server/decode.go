@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hankgao/superwallet-server/server/internal/txdecode"
+	"github.com/skycoin/skycoin/src/coin"
+	"github.com/skycoin/skycoin/src/util/droplet"
+	"github.com/skycoin/skycoin/src/visor"
+)
+
+// decodeTransaction decodes a raw transaction and looks up the owner, amount and hours of its inputs on the node
+func decodeTransaction(ctx context.Context, coinType, rawtx string) (*txdecode.Transaction, error) {
+	dt, err := txdecode.Skycoin(coinType, rawtx)
+	if err != nil {
+		return nil, ruleError(ruleDecode, "%v", err)
+	}
+
+	c := newNodeClient(coinType)
+
+	var bm *visor.BlockchainMetadata
+	err = observeNodeCall(ctx, coinType, "blockchainMetadata", func() error {
+		var err error
+		bm, err = c.BlockchainMetadata()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var droplets uint64
+	for i := range dt.Inputs {
+		in := &dt.Inputs[i]
+
+		ux, err := getUxOut(ctx, c, coinType, in.ID)
+		switch {
+		case isNotFound(err):
+			return nil, inputError(i, ruleInputExists, "output %s doesn't exist", in.ID)
+		case err != nil:
+			return nil, err
+		}
+
+		in.Address = ux.OwnerAddress
+		in.Amount, err = droplet.ToString(ux.Coins)
+		if err != nil {
+			return nil, err
+		}
+
+		// hours an output can spend grow with time, they are counted at the time of the head block like the node does
+		uo := coin.UxOut{
+			Head: coin.UxHead{Time: ux.Time},
+			Body: coin.UxBody{Coins: ux.Coins, Hours: ux.Hours},
+		}
+		in.Hours, err = uo.CoinHours(bm.Head.Time)
+		if err != nil {
+			return nil, err
+		}
+
+		droplets += ux.Coins
+		dt.InputHours += in.Hours
+	}
+
+	dt.InputAmount, err = droplet.ToString(droplets)
+	if err != nil {
+		return nil, err
+	}
+
+	if dt.InputHours >= dt.OutputHours {
+		dt.BurnedHours = dt.InputHours - dt.OutputHours
+	}
+
+	if cm, _ := coins.get(coinType); !cm.CoinHours {
+		dt.InputHours, dt.OutputHours, dt.BurnedHours = 0, 0, 0
+		for i := range dt.Inputs {
+			dt.Inputs[i].Hours = 0
+		}
+		for i := range dt.Outputs {
+			dt.Outputs[i].Hours = 0
+		}
+	}
+
+	return dt, nil
+}
+
+// decodeTransactionHandler returns a normalized view of a raw transaction posted as {"rawtx": "..."},
+// see txdecode.Transaction
+func decodeTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	coinType := vars["coinType"]
+
+	if !isCoinTypeSupported(coinType) {
+		http.Error(w, fmt.Sprintf("%s is not supported", coinType), http.StatusForbidden)
+		return
+	}
+
+	rawtx := struct {
+		Rawtx string `json:"rawtx"`
+	}{}
+
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("[%s] %s", coinType, err), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := json.Unmarshal(b, &rawtx); err != nil {
+		http.Error(w, fmt.Sprintf("[%s] %s", coinType, err), http.StatusBadRequest)
+		return
+	}
+
+	dt, err := decodeTransaction(r.Context(), coinType, rawtx.Rawtx)
+	if e, ok := err.(*txRuleError); ok {
+		writeTxRuleError(w, e)
+		return
+	}
+	if err != nil {
+		requestLogger(r).Errorf("failed to decode transaction: %s", err)
+		http.Error(w, fmt.Sprintf("[%s] failed to decode transaction: %s", coinType, err), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.MarshalIndent(dt, "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal transaction: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/coin"
+)
+
+func TestDecodeTransaction(t *testing.T) {
+	const headTime = 1500000000
+
+	pk, sk := cipher.GenerateKeyPair()
+	owner := cipher.AddressFromPubKey(pk)
+
+	old := cipher.SumSHA256([]byte("old"))
+	recent := cipher.SumSHA256([]byte("recent"))
+	missing := cipher.SumSHA256([]byte("missing"))
+
+	uxouts := map[string]uxOut{
+		// 2 coins created an hour before the head block earned 2 hours
+		old.Hex():    {Uxid: old.Hex(), Time: headTime - 3600, OwnerAddress: owner.String(), Coins: 2e6, Hours: 10},
+		recent.Hex(): {Uxid: recent.Hex(), Time: headTime, OwnerAddress: owner.String(), Coins: 1e6, Hours: 8},
+	}
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/uxout":
+			ux, ok := uxouts[r.URL.Query().Get("uxid")]
+			if !ok {
+				http.Error(w, "404 Not Found", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(ux)
+		case "/api/v1/blockchain/metadata":
+			w.Write([]byte(`{"head": {"seq": 10, "timestamp": 1500000000}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer node.Close()
+	u, _ := url.Parse(node.URL)
+
+	defer func(c *coinRegistry, sc serverConfig) {
+		coins, cfg = c, sc
+	}(coins, cfg)
+	coins = &coinRegistry{list: skywallet.CoinMetas{
+		{NameInEnglish: "skycoin", Symbol: "SKY", WebInterfacePort: u.Port(), CoinHours: true},
+		{NameInEnglish: "mzcoin", Symbol: "MZC", WebInterfacePort: u.Port()},
+	}}
+	cfg = defaultConfig()
+	cfg.NodeServer = "http://127.0.0.1"
+
+	rawtx := func(ins ...cipher.SHA256) string {
+		var tx coin.Transaction
+		keys := make([]cipher.SecKey, len(ins))
+		for i, in := range ins {
+			tx.PushInput(in)
+			keys[i] = sk
+		}
+		tx.PushOutput(owner, 3e6, 5)
+		tx.SignInputs(keys)
+		tx.UpdateHeader()
+		return hex.EncodeToString(tx.Serialize())
+	}
+
+	dt, err := decodeTransaction(context.Background(), "skycoin", rawtx(old, recent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []skywallet.DecodedInput{
+		{ID: old.Hex(), Address: owner.String(), Amount: "2.000000", Hours: 12},
+		{ID: recent.Hex(), Address: owner.String(), Amount: "1.000000", Hours: 8},
+	}
+	if len(dt.Inputs) != 2 || dt.Inputs[0] != expected[0] || dt.Inputs[1] != expected[1] {
+		t.Errorf("inputs should be looked up on the node, got %+v", dt.Inputs)
+	}
+	if dt.InputAmount != "3.000000" || dt.InputHours != 20 || dt.OutputHours != 5 || dt.BurnedHours != 15 {
+		t.Errorf("unexpected totals %+v", dt)
+	}
+
+	// coins without coin hours don't report them
+	dt, err = decodeTransaction(context.Background(), "mzcoin", rawtx(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dt.InputHours != 0 || dt.OutputHours != 0 || dt.BurnedHours != 0 || dt.Inputs[0].Hours != 0 || dt.Outputs[0].Hours != 0 {
+		t.Errorf("hours should be zeroed, got %+v", dt)
+	}
+	if dt.InputAmount != "2.000000" || dt.Inputs[0].Address != owner.String() {
+		t.Errorf("inputs should still be looked up, got %+v", dt)
+	}
+
+	_, err = decodeTransaction(context.Background(), "skycoin", rawtx(old, missing))
+	if e, ok := err.(*txRuleError); !ok || e.Rule != ruleInputExists || e.Input == nil || *e.Input != 1 {
+		t.Errorf("expected an inputExists error of input 1, got %v", err)
+	}
+
+	_, err = decodeTransaction(context.Background(), "skycoin", "zz")
+	if e, ok := err.(*txRuleError); !ok || e.Rule != ruleDecode {
+		t.Errorf("expected a decode error, got %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/skycoin/skycoin/src/daemon"
+	"github.com/skycoin/skycoin/src/visor"
+)
+
+// nodeStatus is what we know about the node of a coin after the last check
+type nodeStatus struct {
+	CoinType           string `json:"coinType"`
+	Reachable          bool   `json:"reachable"`
+	Error              string `json:"error,omitempty"`
+	NodeVersion        string `json:"nodeVersion"`
+	ExpectedVersion    string `json:"expectedVersion"`
+	VersionCompatible  bool   `json:"versionCompatible"`
+	BlockHeight        uint64 `json:"blockHeight"`
+	HighestBlockHeight uint64 `json:"highestBlockHeight"`
+	LastBlockTime      uint64 `json:"lastBlockTime"` // unix time
+	Synced             bool   `json:"synced"`
+	CheckedAt          int64  `json:"checkedAt"` // unix time
+}
+
+// checkNode queries the node of coinType for its version, head block and sync progress
+func checkNode(coinType string) nodeStatus {
+	cm, _ := coins.get(coinType)
+	st := nodeStatus{
+		CoinType:        coinType,
+		ExpectedVersion: cm.NodeVersion,
+		CheckedAt:       time.Now().Unix(),
+	}
+
+	c := newNodeClient(coinType)
+
+	var bm *visor.BlockchainMetadata
+	err := observeNodeCall(context.Background(), coinType, "blockchainMetadata", func() error {
+		var err error
+		bm, err = c.BlockchainMetadata()
+		return err
+	})
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+
+	st.Reachable = true
+	st.BlockHeight = bm.Head.BkSeq
+	st.LastBlockTime = bm.Head.Time
+
+	var bi *visor.BuildInfo
+	err = observeNodeCall(context.Background(), coinType, "version", func() error {
+		var err error
+		bi, err = c.Version()
+		return err
+	})
+	if err != nil {
+		log.Warnf("[%s] failed to get node version: %s", coinType, err)
+	} else {
+		st.NodeVersion = bi.Version
+		st.VersionCompatible, err = nodeVersionCompatible(st.ExpectedVersion, st.NodeVersion)
+		if err != nil {
+			log.Warnf("[%s] %s", coinType, err)
+		}
+		recordNodeVersion(coinType, st.VersionCompatible)
+	}
+
+	var bp *daemon.BlockchainProgress
+	err = observeNodeCall(context.Background(), coinType, "blockchainProgress", func() error {
+		var err error
+		bp, err = c.BlockchainProgress()
+		return err
+	})
+	if err != nil {
+		log.Warnf("[%s] failed to get blockchain progress: %s", coinType, err)
+	} else {
+		st.HighestBlockHeight = bp.Highest
+		st.Synced = bp.Current >= bp.Highest
+	}
+
+	return st
+}
+
+// healthHandler reports that the process is alive
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// readyHandler reports whether the server can serve requests, i.e, nodes have been checked
+// and at least one of them is reachable. The reachability of each coin is returned as well
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := watcher.statuses()
+
+	ready := false
+	enabled := coins.enabled()
+	reachable := make(map[string]bool, len(enabled))
+	for coinType := range enabled {
+		st, ok := statuses[coinType]
+		reachable[coinType] = ok && st.Reachable
+		ready = ready || reachable[coinType]
+	}
+
+	bytes, err := json.MarshalIndent(reachable, "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal readiness: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	w.Write(bytes)
+}
+
+// coinStatusHandler returns the last known node status of a coin
+func coinStatusHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	coinType := vars["coinType"]
+
+	if !isCoinTypeSupported(coinType) {
+		http.Error(w, fmt.Sprintf("%s is not supported", coinType), http.StatusForbidden)
+		return
+	}
+
+	st, ok := watcher.status(coinType)
+	if !ok {
+		http.Error(w, fmt.Sprintf("[%s] node has not been checked yet", coinType), http.StatusServiceUnavailable)
+		return
+	}
+
+	bytes, err := json.MarshalIndent(st, "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("[%s] failed to marshal status: %s", coinType, err), http.StatusInternalServerError)
+		return
+	}
+
+	if !st.Reachable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	w.Write(bytes)
+}
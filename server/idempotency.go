@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+
+	// set on responses replayed for a request with an idempotency key that was already used
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// injection is the result of an injection request with an idempotency key, done is closed once it is known
+type injection struct {
+	done      chan struct{}
+	createdAt time.Time
+
+	// the transaction injected with the key, skycoin signatures are not deterministic so a retry
+	// signing the same transaction again has another txid but the same inner hash
+	innerHash string
+	txid      string
+
+	status      int
+	contentType string
+	body        []byte
+}
+
+func (e *injection) replay(w http.ResponseWriter) {
+	if e.contentType != "" {
+		w.Header().Set("Content-Type", e.contentType)
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+}
+
+// injectionCache keeps the results of injection requests by idempotency key, so that a client
+// retrying a request whose response it didn't get, i.e, after a timeout, gets the original result
+// instead of injecting a second transaction. Only successful results are kept, for ttl, a failed
+// request can be retried with the same key
+type injectionCache struct {
+	ttl time.Duration
+
+	sync.Mutex
+	entries map[string]*injection // keyed by coin and idempotency key
+}
+
+func newInjectionCache(ttl time.Duration) *injectionCache {
+	return &injectionCache{
+		ttl:     ttl,
+		entries: make(map[string]*injection),
+	}
+}
+
+// begin returns the injection of a key, first is true when there was none, the caller must then call finish.
+// The caller checks that the transaction of an existing injection is the one of its request, see sameTx
+func (ic *injectionCache) begin(coinType, key, innerHash, txid string) (e *injection, first bool) {
+	ic.Lock()
+	defer ic.Unlock()
+
+	now := time.Now()
+	for k, e := range ic.entries {
+		select {
+		case <-e.done:
+			if now.Sub(e.createdAt) > ic.ttl {
+				delete(ic.entries, k)
+			}
+		default:
+		}
+	}
+
+	k := txKey(coinType, key)
+	if e, ok := ic.entries[k]; ok {
+		return e, false
+	}
+
+	e = &injection{
+		done:      make(chan struct{}),
+		createdAt: now,
+		innerHash: innerHash,
+		txid:      txid,
+	}
+	ic.entries[k] = e
+	return e, true
+}
+
+// finish records the response of the first request with a key and releases the requests waiting for it
+func (ic *injectionCache) finish(coinType, key string, e *injection, rc *responseCapture) {
+	ic.Lock()
+	defer ic.Unlock()
+
+	e.status = rc.status
+	e.contentType = rc.Header().Get("Content-Type")
+	e.body = rc.body.Bytes()
+	close(e.done)
+
+	if e.status != http.StatusOK {
+		delete(ic.entries, txKey(coinType, key))
+	}
+}
+
+// serve runs the first injection of a key, capturing its response for the retries waiting on e.
+// A panic of inject still finishes e, as a 500, so that retries don't wait forever
+func (ic *injectionCache) serve(coinType, key string, e *injection, w http.ResponseWriter, r *http.Request, inject http.HandlerFunc) {
+	rc := &responseCapture{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		if p := recover(); p != nil {
+			rc.status = http.StatusInternalServerError
+			rc.body.Reset()
+			rc.body.WriteString(http.StatusText(http.StatusInternalServerError) + "\n")
+			ic.finish(coinType, key, e, rc)
+			panic(p)
+		}
+	}()
+
+	inject(rc, r)
+	ic.finish(coinType, key, e, rc)
+}
+
+// sameTx reports whether a retry with the key of e injects the same transaction
+func (e *injection) sameTx(innerHash string) bool {
+	return e.innerHash == innerHash
+}
+
+// injectedTx returns the inner hash and txid of the transaction of an injection request body,
+// empty when it can't be decoded, the request is then refused by injectRawTx
+func injectedTx(body []byte) (innerHash, txid string) {
+	req := struct {
+		Rawtx string `json:"rawtx"`
+	}{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return "", ""
+	}
+
+	tx, err := decodeRawTx(req.Rawtx)
+	if err != nil {
+		return "", ""
+	}
+	return tx.InnerHash.Hex(), tx.Hash().Hex()
+}
+
+// responseCapture keeps a copy of the status and body written to a response
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rc *responseCapture) WriteHeader(code int) {
+	rc.status = code
+	rc.ResponseWriter.WriteHeader(code)
+}
+
+func (rc *responseCapture) Write(b []byte) (int, error) {
+	rc.body.Write(b)
+	return rc.ResponseWriter.Write(b)
+}
+
+// transactionKnown reports whether a transaction is in the pool of the node or confirmed
+func transactionKnown(ctx context.Context, coinType, txid string) bool {
+	tr, err := getTransaction(ctx, coinType, txid)
+	return err == nil && (tr.Status.Confirmed || tr.Status.Unconfirmed)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/coin"
+)
+
+func TestInjectionCache(t *testing.T) {
+	ic := newInjectionCache(time.Hour)
+
+	e, first := ic.begin("skycoin", "k", "inner", "tx")
+	if !first {
+		t.Fatal("first request with a key should inject")
+	}
+
+	waiting, first := ic.begin("skycoin", "k", "inner", "tx")
+	if first || waiting != e {
+		t.Fatal("second request should wait for the first")
+	}
+	if other, first := ic.begin("mzcoin", "k", "inner", "tx"); !first || other == e {
+		t.Fatal("keys of different coins should not collide")
+	}
+
+	rc := &responseCapture{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK}
+	rc.Write([]byte("txid"))
+	ic.finish("skycoin", "k", e, rc)
+
+	<-waiting.done
+	w := httptest.NewRecorder()
+	waiting.replay(w)
+	if w.Code != http.StatusOK || w.Body.String() != "txid" || w.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Fatalf("unexpected replay %d %s", w.Code, w.Body.String())
+	}
+
+	if _, first := ic.begin("skycoin", "k", "inner", "tx"); first {
+		t.Fatal("successful results should be kept")
+	}
+}
+
+func TestInjectionCacheFailure(t *testing.T) {
+	ic := newInjectionCache(time.Hour)
+
+	e, _ := ic.begin("skycoin", "k", "inner", "tx")
+	rc := &responseCapture{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK}
+	http.Error(rc, "node is down", http.StatusInternalServerError)
+	ic.finish("skycoin", "k", e, rc)
+
+	if e.status != http.StatusInternalServerError {
+		t.Fatalf("unexpected status %d", e.status)
+	}
+	if _, first := ic.begin("skycoin", "k", "inner", "tx"); !first {
+		t.Fatal("failed requests should be retried")
+	}
+}
+
+func TestInjectionCachePanic(t *testing.T) {
+	ic := newInjectionCache(time.Hour)
+
+	e, _ := ic.begin("skycoin", "k", "inner", "tx")
+	waiting, _ := ic.begin("skycoin", "k", "inner", "tx")
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Fatalf("the panic should go on, got %v", p)
+			}
+		}()
+		ic.serve("skycoin", "k", e, httptest.NewRecorder(), httptest.NewRequest("POST", "/skycoin/injectTransaction", nil), func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("half"))
+			panic("boom")
+		})
+	}()
+
+	select {
+	case <-waiting.done:
+	default:
+		t.Fatal("waiting retries should be released")
+	}
+	w := httptest.NewRecorder()
+	waiting.replay(w)
+	if w.Code != http.StatusInternalServerError || w.Body.String() != "Internal Server Error\n" {
+		t.Fatalf("unexpected replay %d %s", w.Code, w.Body.String())
+	}
+	if _, first := ic.begin("skycoin", "k", "inner", "tx"); !first {
+		t.Fatal("the key should be usable again")
+	}
+}
+
+func TestInjectionCacheExpiry(t *testing.T) {
+	ic := newInjectionCache(time.Minute)
+
+	e, _ := ic.begin("skycoin", "k", "inner", "tx")
+	ic.finish("skycoin", "k", e, &responseCapture{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK})
+	e.createdAt = time.Now().Add(-time.Hour)
+
+	if _, first := ic.begin("skycoin", "k", "inner", "tx"); !first {
+		t.Fatal("expired results should be dropped")
+	}
+}
+
+func TestInjectedTx(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+	addr := cipher.AddressFromPubKey(pk)
+
+	rawtx := func(coins uint64) []byte {
+		var tx coin.Transaction
+		tx.PushInput(cipher.SumSHA256([]byte("ux")))
+		tx.PushOutput(addr, coins, 1)
+		tx.SignInputs([]cipher.SecKey{sk})
+		tx.UpdateHeader()
+		return []byte(fmt.Sprintf(`{"rawtx": "%s"}`, hex.EncodeToString(tx.Serialize())))
+	}
+
+	inner, txid := injectedTx(rawtx(1e6))
+	if inner == "" || txid == "" {
+		t.Fatal("transaction should be decoded")
+	}
+
+	e := &injection{innerHash: inner, txid: txid}
+	if again, _ := injectedTx(rawtx(1e6)); !e.sameTx(again) {
+		t.Fatal("signing the same transaction again is a retry")
+	}
+	if other, _ := injectedTx(rawtx(2e6)); e.sameTx(other) {
+		t.Fatal("another transaction reusing the key is not a retry")
+	}
+
+	if inner, txid := injectedTx([]byte(`{"rawtx": "zz"}`)); inner != "" || txid != "" {
+		t.Fatal("invalid transactions have no hash")
+	}
+}
@@ -0,0 +1,95 @@
+// Package txdecode holds the normalized view of raw transactions shared by the server and the
+// mobile package, it is internal so that it isn't part of the mobile bindings
+package txdecode
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/skycoin/skycoin/src/coin"
+	"github.com/skycoin/skycoin/src/util/droplet"
+)
+
+// Transaction is a normalized view of a raw transaction, see mobile.DecodeRawTransaction.
+// Amounts are in coins, i.e, "1.5". Hours are only set for skycoin forks, whose fee is the
+// coin hours burned, bitcoin's fee is the input amount minus the output amount.
+// Input amounts and hours are empty when the inputs couldn't be looked up
+type Transaction struct {
+	CoinType     string   `json:"coinType"`
+	Txid         string   `json:"txid"`
+	Size         int      `json:"size"` // bytes
+	Inputs       []Input  `json:"inputs"`
+	Outputs      []Output `json:"outputs"`
+	InputAmount  string   `json:"inputAmount,omitempty"`
+	OutputAmount string   `json:"outputAmount"`
+	Fee          string   `json:"fee,omitempty"`
+	InputHours   uint64   `json:"inputHours,omitempty"`
+	OutputHours  uint64   `json:"outputHours,omitempty"`
+	BurnedHours  uint64   `json:"burnedHours,omitempty"`
+}
+
+// Input is an input of a Transaction, ID is the uxid of the spent output for
+// skycoin forks and txid:vout for bitcoin
+type Input struct {
+	ID      string `json:"id"`
+	Address string `json:"address,omitempty"`
+	Amount  string `json:"amount,omitempty"`
+	Hours   uint64 `json:"hours,omitempty"`
+}
+
+// Output is an output of a Transaction
+type Output struct {
+	Address string `json:"address"`
+	Amount  string `json:"amount"`
+	Hours   uint64 `json:"hours,omitempty"`
+}
+
+// Skycoin decodes a raw transaction of a skycoin fork without looking up its inputs,
+// only their IDs are set
+func Skycoin(coinType, rawtx string) (*Transaction, error) {
+	b, err := hex.DecodeString(rawtx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %v", err)
+	}
+
+	tx, err := coin.TransactionDeserialize(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+
+	dt := &Transaction{
+		CoinType: coinType,
+		Txid:     tx.Hash().Hex(),
+		Size:     len(b),
+		Inputs:   []Input{},
+		Outputs:  []Output{},
+	}
+
+	for _, in := range tx.In {
+		dt.Inputs = append(dt.Inputs, Input{ID: in.Hex()})
+	}
+
+	var coins uint64
+	for _, o := range tx.Out {
+		amount, err := droplet.ToString(o.Coins)
+		if err != nil {
+			return nil, err
+		}
+
+		dt.Outputs = append(dt.Outputs, Output{
+			Address: o.Address.String(),
+			Amount:  amount,
+			Hours:   o.Hours,
+		})
+
+		coins += o.Coins
+		dt.OutputHours += o.Hours
+	}
+
+	dt.OutputAmount, err = droplet.ToString(coins)
+	if err != nil {
+		return nil, err
+	}
+
+	return dt, nil
+}
@@ -0,0 +1,50 @@
+package txdecode
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/coin"
+)
+
+func TestSkycoin(t *testing.T) {
+	pk, sk := cipher.GenerateKeyPair()
+	addr := cipher.AddressFromPubKey(pk)
+	in := cipher.SumSHA256([]byte("ux"))
+
+	var tx coin.Transaction
+	tx.PushInput(in)
+	tx.PushOutput(addr, 1500000, 10)
+	tx.PushOutput(addr, 2000000, 5)
+	tx.SignInputs([]cipher.SecKey{sk})
+	tx.UpdateHeader()
+	b := tx.Serialize()
+
+	dt, err := Skycoin("skycoin", hex.EncodeToString(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dt.CoinType != "skycoin" || dt.Txid != tx.Hash().Hex() || dt.Size != len(b) {
+		t.Errorf("unexpected transaction %+v", dt)
+	}
+	if len(dt.Inputs) != 1 || dt.Inputs[0] != (Input{ID: in.Hex()}) {
+		t.Errorf("only the IDs of inputs should be set, got %+v", dt.Inputs)
+	}
+	if len(dt.Outputs) != 2 || dt.Outputs[0] != (Output{Address: addr.String(), Amount: "1.500000", Hours: 10}) {
+		t.Errorf("unexpected outputs %+v", dt.Outputs)
+	}
+	if dt.OutputAmount != "3.500000" || dt.OutputHours != 15 {
+		t.Errorf("unexpected output totals %s and %d", dt.OutputAmount, dt.OutputHours)
+	}
+	if dt.InputAmount != "" || dt.InputHours != 0 || dt.BurnedHours != 0 {
+		t.Errorf("inputs are not looked up, got %+v", dt)
+	}
+
+	for _, rawtx := range []string{"zz", "00ff"} {
+		if _, err := Skycoin("skycoin", rawtx); err == nil {
+			t.Errorf("%s should not be decoded", rawtx)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+)
+
+// maxLanguages bounds how many languages of an Accept-Language header are considered,
+// responses are cached per language list
+const maxLanguages = 3
+
+// parseAcceptLanguage returns the lower cased language tags of an Accept-Language header
+// by decreasing preference, e.g, "zh-CN,zh;q=0.9,en;q=0.8" gives [zh-cn zh en]
+func parseAcceptLanguage(header string) []string {
+	type tag struct {
+		name string
+		q    float64
+	}
+
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" || name == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				v, err := strconv.ParseFloat(f[2:], 64)
+				if err != nil {
+					v = 0
+				}
+				q = v
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		tags = append(tags, tag{name, q})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	var ret []string
+	for _, t := range tags {
+		if len(ret) == maxLanguages {
+			break
+		}
+		ret = append(ret, t.name)
+	}
+	return ret
+}
+
+// localizedNames returns the names of a coin keyed by lower cased language tag
+func localizedNames(cm skywallet.CoinMeta) map[string]string {
+	names := map[string]string{
+		"en": cm.NameInEnglish,
+	}
+	if cm.NameInChinese != "" {
+		names["zh"] = cm.NameInChinese
+	}
+	for lang, name := range cm.LocalizedNames {
+		names[strings.ToLower(lang)] = name
+	}
+	return names
+}
+
+// displayName returns the name of a coin in the first of langs it has a name for, a language
+// also matches its base language, i.e, zh-CN matches zh. English is the default
+func displayName(cm skywallet.CoinMeta, langs []string) string {
+	names := localizedNames(cm)
+	for _, lang := range langs {
+		if name, ok := names[lang]; ok {
+			return name
+		}
+		if i := strings.IndexByte(lang, '-'); i > 0 {
+			if name, ok := names[lang[:i]]; ok {
+				return name
+			}
+		}
+	}
+	return cm.NameInEnglish
+}
+
+// resolveLanguages keeps the languages of langs that one of metas has a name for, directly or by
+// their base language, so that responses are cached per language served rather than per header
+func resolveLanguages(langs []string, metas map[string]skywallet.CoinMeta) []string {
+	known := make(map[string]bool)
+	for _, cm := range metas {
+		for lang := range localizedNames(cm) {
+			known[lang] = true
+		}
+	}
+
+	var ret []string
+	seen := make(map[string]bool)
+	for _, lang := range langs {
+		if !known[lang] {
+			if i := strings.IndexByte(lang, '-'); i > 0 && known[lang[:i]] {
+				lang = lang[:i]
+			} else {
+				continue
+			}
+		}
+		if !seen[lang] {
+			seen[lang] = true
+			ret = append(ret, lang)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	for header, expect := range map[string][]string{
+		"":                                nil,
+		"zh-CN,zh;q=0.9,en;q=0.8":         {"zh-cn", "zh", "en"},
+		"en;q=0.5, ja":                    {"ja", "en"},
+		"*, fr;q=0, de;q=x":               nil,
+		"a;q=0.1,b;q=0.2,c;q=0.3,d;q=0.4": {"d", "c", "b"},
+	} {
+		if got := parseAcceptLanguage(header); !reflect.DeepEqual(got, expect) {
+			t.Errorf("%q: expected %v, got %v", header, expect, got)
+		}
+	}
+}
+
+func TestDisplayName(t *testing.T) {
+	cm := skywallet.CoinMeta{
+		NameInEnglish:  "skycoin",
+		NameInChinese:  "天空币",
+		LocalizedNames: map[string]string{"zh-TW": "天空幣", "ja": "スカイコイン"},
+	}
+
+	for _, tc := range []struct {
+		langs  []string
+		expect string
+	}{
+		{nil, "skycoin"},
+		{[]string{"fr"}, "skycoin"},
+		{[]string{"zh-cn"}, "天空币"},
+		{[]string{"zh-tw"}, "天空幣"},
+		{[]string{"fr", "ja"}, "スカイコイン"},
+	} {
+		if got := displayName(cm, tc.langs); got != tc.expect {
+			t.Errorf("%v: expected %s, got %s", tc.langs, tc.expect, got)
+		}
+	}
+}
+
+func TestResolveLanguages(t *testing.T) {
+	coins := map[string]skywallet.CoinMeta{
+		"skycoin": {NameInEnglish: "skycoin", NameInChinese: "天空币", LocalizedNames: map[string]string{"zh-TW": "天空幣"}},
+		"mzcoin":  {NameInEnglish: "mzcoin", LocalizedNames: map[string]string{"ja": "エムゼットコイン"}},
+	}
+
+	for _, tc := range []struct {
+		langs  []string
+		expect []string
+	}{
+		{nil, nil},
+		{[]string{"x-made-up", "fr"}, nil},
+		{[]string{"zh-cn", "zh", "en"}, []string{"zh", "en"}},
+		{[]string{"zh-tw", "ja-jp"}, []string{"zh-tw", "ja"}},
+	} {
+		if got := resolveLanguages(tc.langs, coins); !reflect.DeepEqual(got, tc.expect) {
+			t.Errorf("%v: expected %v, got %v", tc.langs, tc.expect, got)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// requestIDHeader carries the request ID, the mobile package sets it so that client and server logs can be correlated
+const requestIDHeader = "X-Request-Id"
+
+// redactedParams are query parameters whose values never go to the logs, request bodies are not logged at all
+var redactedParams = map[string]bool{
+	"rawtx":      true,
+	"seckey":     true,
+	"secret":     true,
+	"privatekey": true,
+	"key":        true,
+	"apikey":     true,
+	"api_key":    true,
+	"token":      true,
+}
+
+type requestInfoKey struct{}
+
+// requestInfo is attached to the context of each request, node calls add their latency to it
+// and the auth middleware the name of the API key
+type requestInfo struct {
+	id string
+
+	sync.Mutex
+	upstream time.Duration
+	keyName  string
+}
+
+func (ri *requestInfo) addUpstream(d time.Duration) {
+	ri.Lock()
+	ri.upstream += d
+	ri.Unlock()
+}
+
+func (ri *requestInfo) upstreamLatency() time.Duration {
+	ri.Lock()
+	defer ri.Unlock()
+	return ri.upstream
+}
+
+func (ri *requestInfo) setKeyName(name string) {
+	ri.Lock()
+	ri.keyName = name
+	ri.Unlock()
+}
+
+func (ri *requestInfo) apiKeyName() string {
+	ri.Lock()
+	defer ri.Unlock()
+	return ri.keyName
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	ri, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return ri
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts IDs sent by clients only if they are reasonably short and printable,
+// so that they can't be used to inject garbage into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// redactQuery returns the query of a request with sensitive values replaced, and address lists
+// replaced by their length, which is enough to debug and keeps users' addresses out of the logs
+func redactQuery(values url.Values) url.Values {
+	ret := make(url.Values, len(values))
+	for k, vs := range values {
+		switch {
+		case redactedParams[strings.ToLower(k)]:
+			ret[k] = []string{"[REDACTED]"}
+		case k == "addrs":
+			ret[k] = []string{fmt.Sprintf("[%d addresses]", len(normalizeAddrs(strings.Join(vs, ","))))}
+		default:
+			ret[k] = vs
+		}
+	}
+	return ret
+}
+
+// requestLogger returns a logger carrying the request ID and coin of r
+func requestLogger(r *http.Request) *log.Entry {
+	fields := log.Fields{}
+	if ri := requestInfoFrom(r.Context()); ri != nil {
+		fields["request_id"] = ri.id
+	}
+	if coinType := mux.Vars(r)["coinType"]; coinType != "" {
+		fields["coin"] = coinType
+	}
+	return log.WithFields(fields)
+}
+
+// loggingMiddleware assigns a request ID to each request and writes one structured log entry per request
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ri := &requestInfo{id: id}
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, ri))
+
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sr, r)
+
+		route := r.URL.Path
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		entry := requestLogger(r).WithFields(log.Fields{
+			"method":              r.Method,
+			"route":               route,
+			"path":                r.URL.Path,
+			"query":               redactQuery(r.URL.Query()).Encode(),
+			"status":              sr.status,
+			"latency_ms":          float64(time.Since(start)) / float64(time.Millisecond),
+			"upstream_latency_ms": float64(ri.upstreamLatency()) / float64(time.Millisecond),
+			"client_ip":           clientIP(r),
+		})
+		if name := ri.apiKeyName(); name != "" {
+			entry = entry.WithField("api_key", name)
+		}
+
+		switch {
+		case sr.status >= 500:
+			entry.Error("request failed")
+		case sr.status >= 400:
+			entry.Warn("request rejected")
+		default:
+			entry.Info("request served")
+		}
+	})
+}
+
+// setupLogging configures the global logger, format is either json or text
+func setupLogging(format, level string) error {
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(lvl)
+
+	if format == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	}
+
+	return nil
+}
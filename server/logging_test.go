@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestRedactQuery(t *testing.T) {
+	q := url.Values{
+		"addrs":  {"a,b,, c"},
+		"rawtx":  {"deadbeef"},
+		"ApiKey": {"secret"},
+		"txid":   {"abc"},
+	}
+
+	r := redactQuery(q)
+	if v := r.Get("addrs"); v != "[3 addresses]" {
+		t.Errorf("unexpected addrs %q", v)
+	}
+	if v := r.Get("rawtx"); v != "[REDACTED]" {
+		t.Errorf("unexpected rawtx %q", v)
+	}
+	if v := r.Get("ApiKey"); v != "[REDACTED]" {
+		t.Errorf("unexpected ApiKey %q", v)
+	}
+	if v := r.Get("txid"); v != "abc" {
+		t.Errorf("unexpected txid %q", v)
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	for _, id := range []string{"abc", "0f1e-2d3c_4b5a"} {
+		if !validRequestID(id) {
+			t.Errorf("%q should be valid", id)
+		}
+	}
+
+	for _, id := range []string{"", "a b", "a\nb", string(make([]byte, 65))} {
+		if validRequestID(id) {
+			t.Errorf("%q should be invalid", id)
+		}
+	}
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -12,25 +18,114 @@ import (
 	skywallet "github.com/hankgao/superwallet-server/server/mobile"
 	log "github.com/sirupsen/logrus"
 	"github.com/skycoin/skycoin/src/api"
+	"github.com/skycoin/skycoin/src/cipher"
 	"github.com/skycoin/skycoin/src/daemon"
 	"github.com/skycoin/skycoin/src/visor"
+	"github.com/skycoin/skycoin/src/wallet"
+	"golang.org/x/time/rate"
 )
 
-var supportedCoinTypes map[string]skywallet.CoinMeta
-
 var (
-	nodeServer = "http://localhost"
-	serverPort = "6789"
+	respCache *responseCache
+	watcher   *blockWatcher
+	prices    *priceService
+
+	payments      *paymentScanner
+	notifications *notifier
+	streams       *streamHub
+	webhooks      *webhookService
+	tracker       *txTracker
+	injections    *injectionCache
 )
 
-func init() {
-	err := loadCoinsConfig()
+func main() {
+	c, printConfig, err := loadConfig(os.Args[1:])
 	if err != nil {
-		panic(err)
+		log.Fatalf("invalid configuration: %s", err)
 	}
-}
+	cfg = c
 
-func main() {
+	if err := setupLogging(cfg.LogFormat, cfg.LogLevel); err != nil {
+		log.Fatalf("invalid log configuration: %s", err)
+	}
+
+	if printConfig {
+		if err := cfg.print(); err != nil {
+			log.Fatalf("failed to print configuration: %s", err)
+		}
+		return
+	}
+
+	err = loadCoinsConfig(cfg.CoinsConfigFile)
+	if err != nil {
+		log.Fatalf("failed to load coins config: %s", err)
+	}
+
+	respCache = newResponseCache(map[string]time.Duration{
+		cacheGetBalance:        cfg.BalanceCacheTTL,
+		cacheGetOutputs:        cfg.OutputsCacheTTL,
+		cacheGetSupportedCoins: cfg.CoinsCacheTTL,
+	}, cfg.MaxCacheEntries)
+
+	watcher = newBlockWatcher(cfg.BlockPollInterval)
+	watcher.onNewBlock(func(coinType string, height uint64) {
+		respCache.invalidateCoin(coinType)
+	})
+	watcher.onStatusChange(func(coinType string, st nodeStatus) {
+		// the coin list reports which coins are degraded or incompatible
+		respCache.invalidateCoin("")
+	})
+
+	// validated by loadConfig
+	routeLimits, _ := parseRouteLimits(cfg.RouteRateLimits)
+	limiter := newRateLimiter(limit{rate: rate.Limit(cfg.RateLimit), burst: cfg.RateBurst}, routeLimits)
+
+	payments = newPaymentScanner(cfg.MaxScanBlocks, watcher.firstHeight)
+	watcher.onNewBlock(payments.scan)
+
+	subs, err := newSubscriptionStore(cfg.SubscriptionsFile, cfg.MaxSubscriptions, cfg.MaxSubscriptionAddrs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	senders, err := newSenders()
+	if err != nil {
+		log.Fatal(err)
+	}
+	notifications = newNotifier(subs, senders)
+	payments.onPayment(notifications.handlePayment)
+
+	streams = newStreamHub(cfg.PoolPollInterval)
+	watcher.onNewBlock(streams.onNewBlock)
+	payments.onPayment(streams.handlePayment)
+
+	webhooks, err = newWebhookService(cfg.WebhooksFile, cfg.WebhookMaxAttempts, cfg.WebhookRetryDelay)
+	if err != nil {
+		log.Fatal(err)
+	}
+	payments.onPayment(webhooks.handlePayment)
+	// registered after the payment scanner, payments of a block are known before their confirmations are counted
+	watcher.onNewBlock(webhooks.onNewBlock)
+
+	tracker = newTxTracker(cfg.TxCheckInterval, cfg.TxTrackTTL, cfg.MaxRebroadcasts, watcher.height)
+	watcher.onNewBlock(tracker.onNewBlock)
+	injections = newInjectionCache(cfg.IdempotencyTTL)
+
+	// validated by loadConfig
+	providers, _ := parsePriceSources(cfg.PriceSources)
+	priceSymbols, _ := parsePriceSymbols(cfg.PriceSymbols)
+	prices = newPriceService(providers, priceSymbols, parseCodes(cfg.PriceFiats), cfg.PriceInterval, cfg.PriceMaxAge)
+
+	ws := newWorkers()
+	ws.start(watcher.run)
+	ws.start(prices.run)
+	ws.start(notifications.run)
+	ws.start(streams.run)
+	ws.start(streams.runBalanceChecks)
+	ws.start(webhooks.run)
+	ws.start(tracker.run)
+	ws.start(func(quit chan struct{}) {
+		limiter.cleanup(10*time.Minute, quit)
+	})
 
 	//https://github.com/gorilla/mux
 	// prepare routing table
@@ -38,31 +133,126 @@ func main() {
 	r.HandleFunc("/{coinType}/getOutputs", getOutputsHandler)
 	r.HandleFunc("/{coinType}/getBalance", getBalanceHandler)
 	r.HandleFunc("/getSupportedCoins", getSupportedCoinsHandler)
+	r.HandleFunc("/balances", balancesHandler).Methods("POST")
+	r.HandleFunc("/prices", pricesHandler)
+	r.HandleFunc("/subscriptions", subscriptionsHandler).Methods("POST", "DELETE")
 	r.HandleFunc("/{coinType}/injectTransaction", injectRawTxHandler).Methods("POST")
+	r.HandleFunc("/{coinType}/decodeTransaction", decodeTransactionHandler).Methods("POST")
 	r.HandleFunc("/{coinType}/transaction", getTransactionHandler)
-	r.PathPrefix("/static/").HandlerFunc(logoRequestHandler)
+	r.HandleFunc("/{coinType}/txStatus", txStatusHandler)
+	r.HandleFunc("/{coinType}/getTransactions", getAddressTransactionsHandler)
+	r.HandleFunc("/cacheStats", cacheStatsHandler)
+	r.Handle("/metrics", metricsHandler())
+	r.HandleFunc("/health", healthHandler)
+	r.HandleFunc("/ready", readyHandler)
+	r.HandleFunc("/{coinType}/status", coinStatusHandler)
+	r.HandleFunc("/{coinType}/stream", streamHandler)
+	r.PathPrefix("/static/").Handler(newAssetServer(cfg.StaticDir, cfg.StaticMaxAge))
+	r.Use(loggingMiddleware, metricsMiddleware)
+	// rate limiting comes before authentication, so that API keys can't be guessed at full
+	// speed and requests refused with 429 don't use up the daily quota of their key
+	r.Use(limiter.middleware)
+	// the admin API is only available when it can be protected by API keys
+	if cfg.APIKeysFile != "" {
+		registerAdminRoutes(r)
+
+		keys, err := loadKeyStore(cfg.APIKeysFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Infof("API key authentication enabled with %d keys", len(keys.keys))
+		r.Use(keys.middleware)
+	}
+	r.Use(clientVersionMiddleware, nodeCompatibilityMiddleware)
 	http.Handle("/", r)
 
 	// start server
 	srv := &http.Server{
-		Addr: "0.0.0.0:" + serverPort,
-		// Good practice to set timeouts to avoid Slowloris attacks.
-		WriteTimeout: time.Second * 15,
-		ReadTimeout:  time.Second * 15,
-		IdleTimeout:  time.Second * 60,
+		Addr:         net.JoinHostPort(cfg.Host, cfg.Port),
+		WriteTimeout: cfg.WriteTimeout,
+		ReadTimeout:  cfg.ReadTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
 		Handler:      r, // Pass our instance of gorilla/mux in.
 	}
 
-	err := srv.ListenAndServe()
-	if err != nil {
-		log.Errorf("Failed to start server: %s", err)
+	// streams never end by themselves, they are closed when shutdown starts
+	srv.RegisterOnShutdown(streams.closeAll)
+
+	servers := []*http.Server{srv}
+	errc := make(chan error, 1)
+
+	if !tlsEnabled() {
+		go func() {
+			errc <- srv.ListenAndServe()
+		}()
+	} else {
+		tlsConfig, certManager := newTLSConfig()
+		srv.TLSConfig = tlsConfig
+
+		if cfg.RedirectPort != "" {
+			redirectSrv := newRedirectServer(certManager)
+			servers = append(servers, redirectSrv)
+			go serveRedirect(redirectSrv)
+		}
+
+		go func() {
+			// certificates come from TLSConfig.GetCertificate when ACME is used, the file names are empty then
+			errc <- srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		}()
 	}
 
+	// the server failing to start, e.g, its port being in use, is an error for process supervisors
+	err = waitForSignal(errc)
+	shutdown(cfg.ShutdownTimeout, ws, servers...)
+	if err != nil {
+		os.Exit(1)
+	}
 }
 
+// injectRawTxHandler injects a raw transaction, requests with an Idempotency-Key header
+// get the result of the first request with the same key, see injectionCache
 func injectRawTxHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		injectRawTx(w, r)
+		return
+	}
+
+	coinType := mux.Vars(r)["coinType"]
+	if ri := requestInfoFrom(r.Context()); ri != nil {
+		// keys of different API clients don't collide
+		key = ri.apiKeyName() + "/" + key
+	}
+
+	// the body is read twice, here to know the transaction and by injectRawTx
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("[%s] %s", coinType, err), http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	innerHash, txid := injectedTx(body)
+
+	e, first := injections.begin(coinType, key, innerHash, txid)
+	if !first && !e.sameTx(innerHash) {
+		http.Error(w, fmt.Sprintf("%s %s was already used for transaction %s", idempotencyKeyHeader, r.Header.Get(idempotencyKeyHeader), e.txid), http.StatusUnprocessableEntity)
+		return
+	}
+	if !first {
+		select {
+		case <-e.done:
+		case <-r.Context().Done():
+			return
+		}
+		requestLogger(r).Info("replaying result of idempotent injection")
+		e.replay(w)
+		return
+	}
 
-	log.Infof("POST %s", r.URL.Path)
+	injections.serve(coinType, key, e, w, r, injectRawTx)
+}
+
+func injectRawTx(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 	coinType := vars["coinType"]
@@ -71,13 +261,19 @@ func injectRawTxHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if cm, _ := coins.get(coinType); cm.Maintenance {
+		http.Error(w, fmt.Sprintf("%s is under maintenance, please try again later", coinType), http.StatusServiceUnavailable)
+		return
+	}
+
 	rawtx := struct {
 		Rawtx string `json:"rawtx"`
 	}{}
 
-	bytes, err := ioutil.ReadAll(r.Body)
+	// a raw transaction is a few KB at most, don't let clients make us buffer arbitrary amounts of data
+	bytes, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("[%s] %s", coinType, err), http.StatusForbidden)
+		http.Error(w, fmt.Sprintf("[%s] %s", coinType, err), http.StatusRequestEntityTooLarge)
 		return
 	}
 
@@ -87,19 +283,72 @@ func injectRawTxHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Infof("rawtx: \n%s", rawtx.Rawtx)
+	// the raw transaction itself is not logged, only its size
+	requestLogger(r).WithField("rawtx_bytes", len(rawtx.Rawtx)/2).Debug("injecting transaction")
+
+	tx, err := decodeRawTx(rawtx.Rawtx)
+	if err != nil {
+		writeTxRuleError(w, err.(*txRuleError))
+		return
+	}
+	txid := tx.Hash().Hex()
+
+	// a retry of a request whose response the client didn't get, the tracker rebroadcasts it if needed.
+	// Dropped transactions were refused by the node when rebroadcast, they are checked again
+	if st, ok := tracker.status(coinType, txid); ok && (st.Status == txSubmitted || st.Status == txPending || st.Status == txConfirmed) {
+		requestLogger(r).Infof("transaction %s was already injected", txid)
+		w.Write([]byte(txid))
+		return
+	}
 
-	cm := supportedCoinTypes[coinType]
+	if cfg.VerifyTransactions {
+		err := verifyTransaction(r.Context(), coinType, rawtx.Rawtx)
+		if err != nil && transactionKnown(r.Context(), coinType, txid) {
+			// its inputs are spent by the transaction itself
+			requestLogger(r).Infof("transaction %s is already in the pool or confirmed", txid)
+			w.Write([]byte(txid))
+			return
+		}
+		if e, ok := err.(*txRuleError); ok {
+			requestLogger(r).Infof("rejecting invalid transaction: %s", e)
+			writeTxRuleError(w, e)
+			return
+		}
+		if err != nil {
+			requestLogger(r).Errorf("failed to verify transaction: %s", err)
+			http.Error(w, fmt.Sprintf("[%s] failed to verify transaction: %s", coinType, err), http.StatusInternalServerError)
+			return
+		}
+	}
 
-	c := api.NewClient(fmt.Sprintf("%s:%s", nodeServer, cm.WebInterfacePort))
+	c := newNodeClient(coinType)
 
-	txid, err := c.InjectTransaction(rawtx.Rawtx)
+	err = observeNodeCall(r.Context(), coinType, "injectTransaction", func() error {
+		_, err := c.InjectTransaction(rawtx.Rawtx)
+		return err
+	})
+	if err != nil && transactionKnown(r.Context(), coinType, txid) {
+		requestLogger(r).Infof("transaction %s is already in the pool or confirmed: %s", txid, err)
+		err = nil
+	}
+	recordInjectedTx(coinType, err)
 	if err != nil {
-		log.Errorf("failed to inject raw transaction %s", err)
+		requestLogger(r).Errorf("failed to inject raw transaction %s", err)
 		http.Error(w, fmt.Sprintf("[%s] %s", coinType, err), http.StatusForbidden)
 		return
 	}
 
+	tracker.track(coinType, txid, rawtx.Rawtx)
+
+	// balances and outputs of the addresses involved are stale now
+	addrs, err := txAddresses(r.Context(), coinType, rawtx.Rawtx)
+	if err != nil {
+		requestLogger(r).Warnf("failed to get addresses of transaction %s, dropping all cached responses: %s", txid, err)
+		respCache.invalidateCoin(coinType)
+	} else {
+		respCache.invalidateAddrs(coinType, addrs)
+	}
+
 	w.Write([]byte(txid))
 
 }
@@ -117,38 +366,24 @@ This is what is returned
     }
 */
 func getBalanceHandler(w http.ResponseWriter, r *http.Request) {
-	log.Infof("GET %s", r.URL.Path)
-
 	vars := mux.Vars(r)
 	coinType := vars["coinType"]
 
 	if isCoinTypeSupported(coinType) {
-		ctm := supportedCoinTypes[coinType]
-
-		// localhost:webInterfacePort
-		c := api.NewClient(fmt.Sprintf("%s:%s", nodeServer, ctm.WebInterfacePort))
-
 		values := r.URL.Query()
 		// addrs should be comma seperated string
-		addrs := values.Get("addrs")
+		addrs := normalizeAddrs(values.Get("addrs"))
 
-		balance, err := c.Balance(strings.Split(addrs, ","))
+		bytes, err := getBalance(r.Context(), coinType, addrs)
 		if err != nil {
 			//TODO：
-			log.Errorf("failed to get balance %s", err)
+			requestLogger(r).Errorf("failed to get balance %s", err)
 			response := fmt.Sprintf("getBalance handler failed: %s", err)
 			http.Error(w, response, http.StatusInternalServerError) // client needs to check status
 			return
 		}
 
-		bytes, err := json.MarshalIndent(balance, "", "    ")
-		if err != nil {
-			log.Errorf("failed to marshal return balance result: %s", err)
-			response := fmt.Sprintf("getBalance handler failed: %s", err)
-			http.Error(w, response, http.StatusInternalServerError) // client needs to check status
-		}
-
-		w.Write(bytes)
+		writeBalance(w, r, coinType, bytes)
 
 	} else {
 		http.Error(w, fmt.Sprintf("%s is not supported", coinType), http.StatusBadRequest)
@@ -156,73 +391,222 @@ func getBalanceHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// writeBalance writes a getBalance response, with its value in the fiat currency given by the fiat parameter if any,
+// e.g, /skycoin/getBalance?addrs=...&fiat=CNY
+func writeBalance(w http.ResponseWriter, r *http.Request, coinType string, bytes []byte) {
+	fiat := r.URL.Query().Get("fiat")
+	if fiat == "" {
+		w.Write(bytes)
+		return
+	}
+
+	bytes, status, err := withFiatBalance(coinType, fiat, bytes)
+	if err != nil {
+		if status == http.StatusInternalServerError {
+			requestLogger(r).Errorf("failed to add fiat balance: %s", err)
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Write(bytes)
+}
+
+// getSupportedCoinsHandler returns the enabled coins, clients implementing coinListVersion get
+// a list sorted by display order, older clients a map keyed by english name
 func getSupportedCoinsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Infof("GET %s", r.URL.Path)
-	bytes, err := json.MarshalIndent(supportedCoinTypes, "", "    ")
+	// legacy clients don't know about degraded, incompatible and maintenance coins, they get them anyway so that
+	// the wallets of their users don't disappear when a node goes down, nodeCompatibilityMiddleware refuses their requests
+	list := clientImplements(r, coinListVersion)
+	enabled := coins.enabled()
+	langs := resolveLanguages(parseAcceptLanguage(r.Header.Get("Accept-Language")), enabled)
+
+	variant := []string{"map", strings.Join(langs, ";")}
+	if list {
+		variant[0] = "list"
+	}
+
+	w.Header().Set("Vary", "Accept-Language, "+clientVersionHeader)
+
+	if bytes, ok := respCache.get("", cacheGetSupportedCoins, variant); ok {
+		w.Write(bytes)
+		return
+	}
+	gen := respCache.generation("")
+
+	var metas skywallet.CoinMetas
+	for name, cm := range enabled {
+		cm.LogoURL = logoURL(cm.LogoURL)
+		cm.DisplayName = displayName(cm, langs)
+		if st, ok := watcher.status(name); ok {
+			// a coin is degraded when its node has been checked and found unreachable
+			cm.Degraded = !st.Reachable
+			cm.Incompatible = st.NodeVersion != "" && !st.VersionCompatible
+		}
+		metas = append(metas, cm)
+	}
+
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].DisplayOrder != metas[j].DisplayOrder {
+			return metas[i].DisplayOrder < metas[j].DisplayOrder
+		}
+		return metas[i].NameInEnglish < metas[j].NameInEnglish
+	})
+
+	var v interface{} = metas
+	if !list {
+		m := make(map[string]skywallet.CoinMeta, len(metas))
+		for _, cm := range metas {
+			m[cm.NameInEnglish] = cm
+		}
+		v = m
+	}
+
+	bytes, err := json.MarshalIndent(v, "", "    ")
 	if err != nil {
-		log.Errorf("failed to get supported coins %s", err)
+		requestLogger(r).Errorf("failed to get supported coins %s", err)
 		http.Error(w, fmt.Sprintf("getSupported coins failed due to: %s", err), http.StatusForbidden)
 		return
 	}
+
+	respCache.set("", cacheGetSupportedCoins, variant, gen, bytes)
+
 	w.Write(bytes)
 }
 
-func loadCoinsConfig() error {
-	// We expect a configuration file in the current working directory
-	bytes, err := ioutil.ReadFile("coins.config.json")
+func loadCoinsConfig(file string) error {
+	cr, err := loadCoinRegistry(file)
 	if err != nil {
-		log.Errorf("failed to load coin configruation file %s", err)
+		log.Error(err)
 		return err
 	}
 
-	cms := skywallet.CoinMetas{}
-	err = json.Unmarshal(bytes, &cms)
-	if err != nil {
-		log.Errorf("failed to unmarshal configuration data %s", err)
+	coins = cr
+
+	return nil
+}
+
+// getBalance returns the balance of addresses as JSON, from the response cache when possible
+func getBalance(ctx context.Context, coinType string, addrs []string) ([]byte, error) {
+	if bytes, ok := respCache.get(coinType, cacheGetBalance, addrs); ok {
+		return bytes, nil
+	}
+	// a block seen during the node call makes the balance stale, it isn't cached then
+	gen := respCache.generation(coinType)
+
+	// localhost:webInterfacePort
+	c := newNodeClient(coinType)
+
+	var balance *wallet.BalancePair
+	err := observeNodeCall(ctx, coinType, "balance", func() error {
+		var err error
+		balance, err = c.Balance(addrs)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	supportedCoinTypes = make(map[string]skywallet.CoinMeta, len(cms))
-	for _, cm := range cms {
-		supportedCoinTypes[cm.NameInEnglish] = cm
+	bytes, err := json.MarshalIndent(balance, "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal balance: %v", err)
 	}
 
-	return nil
+	respCache.set(coinType, cacheGetBalance, addrs, gen, bytes)
+
+	return bytes, nil
+}
+
+func getOutputs(ctx context.Context, coinType string, addrs []string) (*visor.ReadableOutputSet, error) {
+	if !isCoinTypeSupported(coinType) {
+		return nil, fmt.Errorf("%s type is not supported", coinType)
+	}
+
+	c := newNodeClient(coinType)
+
+	var outputs *visor.ReadableOutputSet
+	err := observeNodeCall(ctx, coinType, "outputs", func() error {
+		var err error
+		outputs, err = c.OutputsForAddresses(addrs)
+		return err
+	})
+
+	return outputs, err
+}
+
+// newNodeClient returns a client of the node of coinType, coinType must be supported
+func newNodeClient(coinType string) *api.Client {
+	// localhost:webInterfacePort
+	cm, _ := coins.get(coinType)
+	return api.NewClient(fmt.Sprintf("%s:%s", cfg.NodeServer, cm.WebInterfacePort))
 }
 
-// example request:
-// http:superwallet.shellpay.com:6789/static/mzc.logo.png
-func logoRequestHandler(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, strings.TrimLeft(r.URL.Path, "/"))
+// txAddresses returns addresses involved in a raw transaction, i.e, owners of its inputs and its outputs
+func txAddresses(ctx context.Context, coinType, rawtx string) ([]string, error) {
+	tx, err := decodeRawTx(rawtx)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newNodeClient(coinType)
+
+	var addrs []string
+	for _, o := range tx.Out {
+		addrs = append(addrs, o.Address.String())
+	}
+
+	for _, in := range tx.In {
+		ux, err := getUxOut(ctx, c, coinType, in.Hex())
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, ux.OwnerAddress)
+	}
+
+	return addrs, nil
 }
 
-func getOutputs(coinType, addrs string) (*visor.ReadableOutputSet, error) {
+func getTransaction(ctx context.Context, coinType, txid string) (*daemon.TransactionResult, error) {
 	if !isCoinTypeSupported(coinType) {
 		return nil, fmt.Errorf("%s type is not supported", coinType)
 	}
 
-	addr := fmt.Sprintf("%s:%s", nodeServer, supportedCoinTypes[coinType].WebInterfacePort)
-	c := api.NewClient(addr)
+	c := newNodeClient(coinType)
 
-	aSlice := strings.Split(addrs, ",")
+	var tr *daemon.TransactionResult
+	err := observeNodeCall(ctx, coinType, "transaction", func() error {
+		var err error
+		tr, err = c.Transaction(txid)
+		return err
+	})
 
-	return c.OutputsForAddresses(aSlice)
+	return tr, err
 }
 
-func getTransaction(coinType, txid string) (*daemon.TransactionResult, error) {
+// getAddressTransactions returns the transactions of each address, keyed by address
+func getAddressTransactions(ctx context.Context, coinType, addrs string) (map[string]json.RawMessage, error) {
 	if !isCoinTypeSupported(coinType) {
 		return nil, fmt.Errorf("%s type is not supported", coinType)
 	}
 
-	addr := fmt.Sprintf("%s:%s", nodeServer, supportedCoinTypes[coinType].WebInterfacePort)
-	c := api.NewClient(addr)
+	c := newNodeClient(coinType)
+
+	txns := make(map[string]json.RawMessage)
+	for _, a := range strings.Split(addrs, ",") {
+		var v json.RawMessage
+		err := observeNodeCall(ctx, coinType, "addressTransactions", func() error {
+			return c.Get("/api/v1/explorer/address?address="+url.QueryEscape(a), &v)
+		})
+		if err != nil {
+			return nil, err
+		}
+		txns[a] = v
+	}
 
-	return c.Transaction(txid)
+	return txns, nil
 }
 
 func getOutputsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Infof("GET %s", r.URL.Path)
-
 	vars := mux.Vars(r)
 	coinType := vars["coinType"]
 
@@ -232,11 +616,17 @@ func getOutputsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	values := r.URL.Query()
-	addrs := values.Get("addrs")
+	addrs := normalizeAddrs(values.Get("addrs"))
+
+	if bytes, ok := respCache.get(coinType, cacheGetOutputs, addrs); ok {
+		w.Write(bytes)
+		return
+	}
+	gen := respCache.generation(coinType)
 
-	o, err := getOutputs(coinType, addrs)
+	o, err := getOutputs(r.Context(), coinType, addrs)
 	if err != nil {
-		log.Errorf("failed to get outputs %s", err)
+		requestLogger(r).Errorf("failed to get outputs %s", err)
 		http.Error(w, fmt.Sprintf("[%s] failed to get outputs: %s ", coinType, err), http.StatusForbidden)
 		return
 	}
@@ -245,18 +635,20 @@ func getOutputsHandler(w http.ResponseWriter, r *http.Request) {
 	so := o.SpendableOutputs()
 	bytes, err := json.MarshalIndent(so, "", "    ")
 	if err != nil {
-		log.Errorf("failed to marshal spendable outputs %s", err)
+		requestLogger(r).Errorf("failed to marshal spendable outputs %s", err)
 		http.Error(w, fmt.Sprintf("[%s] failed to get outputs: %s ", coinType, err), http.StatusForbidden)
 		return
 	}
 
+	respCache.set(coinType, cacheGetOutputs, addrs, gen, bytes)
+
 	w.Write(bytes)
 
 }
 
 func isCoinTypeSupported(coinType string) bool {
-	_, ok := supportedCoinTypes[coinType]
-	if !ok {
+	cm, ok := coins.get(coinType)
+	if !ok || cm.Disabled {
 		return false
 	}
 
@@ -264,8 +656,6 @@ func isCoinTypeSupported(coinType string) bool {
 }
 
 func getTransactionHandler(w http.ResponseWriter, r *http.Request) {
-	log.Infof("GET %s", r.URL.Path)
-
 	vars := mux.Vars(r)
 	coinType := vars["coinType"]
 
@@ -277,7 +667,7 @@ func getTransactionHandler(w http.ResponseWriter, r *http.Request) {
 	values := r.URL.Query()
 	txid := values.Get("txid")
 
-	tr, err := getTransaction(coinType, txid)
+	tr, err := getTransaction(r.Context(), coinType, txid)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to get transaction information for txid :%s", txid), http.StatusInternalServerError)
 		return
@@ -291,3 +681,49 @@ func getTransactionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(txJSON)
 
 }
+
+func getAddressTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	coinType := vars["coinType"]
+
+	if !isCoinTypeSupported(coinType) {
+		http.Error(w, fmt.Sprintf("%s is not supported", coinType), http.StatusForbidden)
+		return
+	}
+
+	values := r.URL.Query()
+	addrs := values.Get("addrs")
+
+	for _, a := range strings.Split(addrs, ",") {
+		if _, err := cipher.DecodeBase58Address(a); err != nil {
+			http.Error(w, fmt.Sprintf("invalid address %s: %v", a, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	txns, err := getAddressTransactions(r.Context(), coinType, addrs)
+	if err != nil {
+		requestLogger(r).Errorf("failed to get address transactions %s", err)
+		http.Error(w, fmt.Sprintf("[%s] failed to get transactions: %s ", coinType, err), http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.MarshalIndent(txns, "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("[%s] failed to marshal transactions: %s ", coinType, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+
+}
+
+func cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	bytes, err := json.MarshalIndent(respCache.snapshot(), "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal cache stats: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+)
+
+func TestGetAddressTransactionsHandler(t *testing.T) {
+	var queried []string
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queried = append(queried, r.URL.RawQuery)
+		w.Write([]byte(`[]`))
+	}))
+	defer node.Close()
+	u, _ := url.Parse(node.URL)
+
+	defer func(c *coinRegistry, sc serverConfig) { coins, cfg = c, sc }(coins, cfg)
+	coins = &coinRegistry{list: skywallet.CoinMetas{
+		{NameInEnglish: "skycoin", Symbol: "SKY", WebInterfacePort: u.Port()},
+	}}
+	cfg = defaultConfig()
+	cfg.NodeServer = "http://127.0.0.1"
+
+	get := func(addrs string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/skycoin/getTransactions?addrs="+url.QueryEscape(addrs), nil)
+		getAddressTransactionsHandler(w, mux.SetURLVars(r, map[string]string{"coinType": "skycoin"}))
+		return w
+	}
+
+	addr := "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv"
+	if w := get(addr + ",x&verbose=1"); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid addresses should be refused, got %d", w.Code)
+	}
+	if len(queried) != 0 {
+		t.Fatalf("node should not be called, got %v", queried)
+	}
+
+	if w := get(addr); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+	if len(queried) != 1 || queried[0] != "address="+addr {
+		t.Fatalf("unexpected node queries %v", queried)
+	}
+}
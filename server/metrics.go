@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "superwallet"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route, coin and status code.",
+	}, []string{"route", "coin", "code"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route and coin.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "coin"})
+
+	nodeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_call_duration_seconds",
+		Help:      "Latency of calls to coin nodes by coin and call.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"coin", "call"})
+
+	nodeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_call_errors_total",
+		Help:      "Number of failed calls to coin nodes by coin and call.",
+	}, []string{"coin", "call"})
+
+	injectedTxs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "injected_transactions_total",
+		Help:      "Number of injected transactions by coin and result (success or failure).",
+	}, []string{"coin", "result"})
+
+	blockHeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "block_height",
+		Help:      "Last block height seen on the node of each coin.",
+	}, []string{"coin"})
+
+	nodeVersionCompatibility = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_version_compatible",
+		Help:      "Whether the node version of each coin matches the configured nodeVersion (1) or not (0).",
+	}, []string{"coin"})
+
+	blockChangedTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "block_height_changed_timestamp_seconds",
+		Help:      "Unix time when the block height of each coin last changed, use it to alert on stalled nodes.",
+	}, []string{"coin"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		httpRequests,
+		httpDuration,
+		nodeDuration,
+		nodeErrors,
+		injectedTxs,
+		blockHeight,
+		blockChangedTime,
+		nodeVersionCompatibility,
+		cacheCollector{},
+	)
+}
+
+// metricsHandler serves metrics in the prometheus exposition format
+func metricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.status = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// Flush lets handlers stream responses, see streamHandler
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// metricsMiddleware counts requests and observes their latency per route and coin
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(sr, r)
+
+		route := "unknown"
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		// only label known coins, otherwise random paths would blow up the number of series
+		coinType := mux.Vars(r)["coinType"]
+		if !isCoinTypeSupported(coinType) {
+			coinType = ""
+		}
+
+		httpRequests.WithLabelValues(route, coinType, strconv.Itoa(sr.status)).Inc()
+		httpDuration.WithLabelValues(route, coinType).Observe(time.Since(start).Seconds())
+	})
+}
+
+// observeNodeCall runs f, a call to the node of coinType, and records its latency and errors,
+// the latency is also added to the upstream latency of the request ctx belongs to, if any
+func observeNodeCall(ctx context.Context, coinType, call string, f func() error) error {
+	start := time.Now()
+	err := f()
+	d := time.Since(start)
+	if ri := requestInfoFrom(ctx); ri != nil {
+		ri.addUpstream(d)
+	}
+	nodeDuration.WithLabelValues(coinType, call).Observe(d.Seconds())
+	if err != nil {
+		nodeErrors.WithLabelValues(coinType, call).Inc()
+	}
+	return err
+}
+
+func recordInjectedTx(coinType string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	injectedTxs.WithLabelValues(coinType, result).Inc()
+}
+
+func recordBlockHeight(coinType string, height uint64, changed bool) {
+	blockHeight.WithLabelValues(coinType).Set(float64(height))
+	if changed {
+		blockChangedTime.WithLabelValues(coinType).SetToCurrentTime()
+	}
+}
+
+func recordNodeVersion(coinType string, compatible bool) {
+	v := 0.0
+	if compatible {
+		v = 1
+	}
+	nodeVersionCompatibility.WithLabelValues(coinType).Set(v)
+}
+
+// cacheCollector exports the response cache stats
+type cacheCollector struct{}
+
+var (
+	cacheHitsDesc = prometheus.NewDesc(metricsNamespace+"_cache_hits_total",
+		"Number of response cache hits by endpoint.", []string{"endpoint"}, nil)
+	cacheMissesDesc = prometheus.NewDesc(metricsNamespace+"_cache_misses_total",
+		"Number of response cache misses by endpoint.", []string{"endpoint"}, nil)
+	cacheInvalidationsDesc = prometheus.NewDesc(metricsNamespace+"_cache_invalidations_total",
+		"Number of response cache entries invalidated by endpoint.", []string{"endpoint"}, nil)
+)
+
+func (cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cacheInvalidationsDesc
+}
+
+func (cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	if respCache == nil {
+		return
+	}
+
+	for endpoint, s := range respCache.snapshot() {
+		ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(s.Hits), endpoint)
+		ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(s.Misses), endpoint)
+		ch <- prometheus.MustNewConstMetric(cacheInvalidationsDesc, prometheus.CounterValue, float64(s.Invalidations), endpoint)
+	}
+}
@@ -7,14 +7,16 @@ import (
 	"strconv"
 	"strings"
 
-	logging "github.com/op/go-logging"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/sirupsen/logrus"
 	"github.com/skycoin/skycoin-exchange/src/coin"
 	"github.com/skycoin/skycoin/src/cipher"
 )
 
 var (
 	HideSeckey = false
-	logger     = logging.MustGetLogger("exchange.bitcoin")
+	logger     = logrus.WithField("module", "bitcoin")
 	Type       = "bitcoin"
 )
 
@@ -80,6 +82,15 @@ func GetUnspentOutputs(addrs []string) ([]Utxo, error) {
 	return getUtxosBlkExplr(addrs)
 }
 
+// GetTransactions returns the transaction history of addresses in JSON format
+func GetTransactions(addrs []string) (string, error) {
+	d, err := getTxsBlkExplr(addrs)
+	if err != nil {
+		return "", err
+	}
+	return string(d), nil
+}
+
 // NewUtxoWithKey create UtxoWithkey struct
 func NewUtxoWithKey(utxo Utxo, key string) UtxoWithkey {
 	return BlkExplrUtxoWithkey{
@@ -103,6 +114,20 @@ func getDataOfUrl(url string) ([]byte, error) {
 	return data, nil
 }
 
+// ValidateAddress checks that addr is a well formed bitcoin main net address with a valid checksum
+func ValidateAddress(addr string) error {
+	a, err := btcutil.DecodeAddress(addr, &chaincfg.MainNetParams)
+	if err != nil {
+		return err
+	}
+
+	if !a.IsForNet(&chaincfg.MainNetParams) {
+		return fmt.Errorf("%s is not a bitcoin main net address", addr)
+	}
+
+	return nil
+}
+
 func validateAddress(addr string) bool {
 	_, err := cipher.BitcoinDecodeBase58Address(addr)
 	return err == nil
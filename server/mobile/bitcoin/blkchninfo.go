@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 )
 
@@ -53,35 +52,30 @@ func (bk BlkChnUtxo) GetAddress() string {
 
 // GetUtxosBlkChnInfo get unspent outputs from blockchain.info
 // https://blockchain.info/unspent?active=1SakrZuzQmGwn7MSiJj5awqJZjSYeBWC3
-func getUtxosBlkChnInfo(addr string) []Utxo {
-	// if AddressValid(addr) != nil {
-	// log.Fatal("Address is invalid")
-	// }
+func getUtxosBlkChnInfo(addr string) ([]Utxo, error) {
 	url := fmt.Sprintf("https://blockchain.info/unspent?active=%s", addr)
-	// fmt.Println(url)
 
 	resp, err := http.Get(url)
 	if err != nil {
-		log.Fatalf("Get url:%s fail, error:%s", addr, err)
+		return nil, fmt.Errorf("get url:%s fail, error:%s", url, err)
 	}
+	defer resp.Body.Close()
 
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		log.Fatalf("Read data from resp body fail, error:%s", err)
+		return nil, fmt.Errorf("read data from resp body fail, error:%s", err)
 	}
-	resp.Body.Close()
-	// fmt.Println("status:", resp.StatusCode)
 
 	// parse the JSON.
 	utxoResp := BlkChnUtxoRsp{}
 	err = json.Unmarshal(data, &utxoResp)
 	if err != nil {
-		log.Fatalf("unmasharl fail, error:%s", err)
+		return nil, fmt.Errorf("unmarshal fail, error:%s", err)
 	}
 
 	utxos := make([]Utxo, len(utxoResp.Utxos))
 	for i, u := range utxoResp.Utxos {
 		utxos[i] = u
 	}
-	return utxos
+	return utxos, nil
 }
@@ -120,6 +120,17 @@ func getRawtxExplr(txid string) (string, error) {
 	return v.Rawtx, nil
 }
 
+// get transactions of addresses from blockexplorer.com, the raw JSON is returned as is
+func getTxsBlkExplr(addrs []string) ([]byte, error) {
+	for _, a := range addrs {
+		if !validateAddress(a) {
+			return nil, fmt.Errorf("invalid bitcoin address %v", a)
+		}
+	}
+
+	return getDataOfUrl(fmt.Sprintf("https://blockexplorer.com/api/addrs/%s/txs", strings.Join(addrs, ",")))
+}
+
 type balanceResult struct {
 	balance uint64
 	err     error
@@ -0,0 +1,101 @@
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+// DecodedTxIn is an input of a decoded transaction, Address and Value are only known when the
+// funding transaction could be looked up, Value is -1 otherwise
+type DecodedTxIn struct {
+	Txid    string
+	Vout    uint32
+	Address string
+	Value   int64 // satoshis
+}
+
+// DecodedTxOut is an output of a decoded transaction, Address is empty for non standard scripts
+type DecodedTxOut struct {
+	Address string
+	Value   int64 // satoshis
+}
+
+// DecodedTx is a decoded raw transaction
+type DecodedTx struct {
+	Txid    string
+	Size    int
+	Inputs  []DecodedTxIn
+	Outputs []DecodedTxOut
+}
+
+// DecodeTx decodes a hex encoded raw transaction. When lookupInputs is set, the funding
+// transactions are looked up on blockchain.info for the address and value of inputs
+func DecodeTx(rawtx string, lookupInputs bool) (*DecodedTx, error) {
+	b, err := hex.DecodeString(rawtx)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex: %v", err)
+	}
+
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+
+	dt := &DecodedTx{
+		Txid: tx.TxHash().String(),
+		Size: tx.SerializeSize(),
+	}
+
+	for _, in := range tx.TxIn {
+		di := DecodedTxIn{
+			Txid:  in.PreviousOutPoint.Hash.String(),
+			Vout:  in.PreviousOutPoint.Index,
+			Value: -1,
+		}
+
+		if lookupInputs {
+			prev, err := lookupTxid(&in.PreviousOutPoint.Hash)
+			if err != nil {
+				logger.Warnf("failed to look up input %s:%d: %v", di.Txid, di.Vout, err)
+			} else if int(di.Vout) < len(prev.Outputs) {
+				out := prev.Outputs[di.Vout]
+				di.Value = int64(out.Value)
+				if script, err := hex.DecodeString(out.ScriptHex); err == nil {
+					di.Address = scriptAddress(script)
+				}
+			}
+		}
+
+		dt.Inputs = append(dt.Inputs, di)
+	}
+
+	for _, out := range tx.TxOut {
+		dt.Outputs = append(dt.Outputs, DecodedTxOut{
+			Address: scriptAddress(out.PkScript),
+			Value:   out.Value,
+		})
+	}
+
+	return dt, nil
+}
+
+// scriptAddress returns the address paid by a public key script, empty when it isn't a standard one
+func scriptAddress(script []byte) string {
+	_, addrs, _, err := txscript.ExtractPkScriptAddrs(script, &chaincfg.MainNetParams)
+	if err != nil || len(addrs) != 1 {
+		return ""
+	}
+	return addrs[0].EncodeAddress()
+}
+
+// FormatBTC formats satoshis as BTC, i.e, 150000000 is 1.5
+func FormatBTC(satoshis int64) string {
+	return strconv.FormatFloat(btcutil.Amount(satoshis).ToBTC(), 'f', -1, 64)
+}
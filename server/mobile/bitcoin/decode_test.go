@@ -0,0 +1,31 @@
+package bitcoin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeTx(t *testing.T) {
+	// one input, one output of 1 BTC paying to the hash160 of zeros
+	rawtx := "01000000" + "01" + strings.Repeat("00", 32) + "00000000" + "00" + "ffffffff" +
+		"01" + "00e1f50500000000" + "1976a914" + strings.Repeat("00", 20) + "88ac" + "00000000"
+
+	tx, err := DecodeTx(rawtx, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 85, tx.Size)
+	assert.Len(t, tx.Inputs, 1)
+	assert.Equal(t, int64(-1), tx.Inputs[0].Value)
+	assert.Len(t, tx.Outputs, 1)
+	assert.Equal(t, "1111111111111111111114oLvT2", tx.Outputs[0].Address)
+	assert.Equal(t, "1", FormatBTC(tx.Outputs[0].Value))
+
+	_, err = DecodeTx("zz", false)
+	assert.NotNil(t, err)
+}
+
+func TestFormatBTC(t *testing.T) {
+	assert.Equal(t, "1.5", FormatBTC(150000000))
+	assert.Equal(t, "0.00000001", FormatBTC(1))
+}
@@ -86,7 +86,10 @@ func (btc Bitcoin) CreateRawTx(txIns []coin.TxIn, txOuts interface{}) (string, e
 		if err != nil {
 			return "", err
 		}
-		txout := createTxOut(out.Value, addr)
+		txout, err := createTxOut(out.Value, addr)
+		if err != nil {
+			return "", err
+		}
 		tx.AddTxOut(txout)
 	}
 
@@ -121,7 +124,7 @@ func (btc Bitcoin) SignRawTx(rawtx string, getKey coin.GetPrivKey) (string, erro
 			return "", err
 		}
 		outs := vt.GetBtc().GetVout()
-		if int(index) > len(outs) {
+		if int(index) >= len(outs) {
 			return "", errors.New("error rawtx")
 		}
 		addr := outs[index].GetScriptPubkey().GetAddresses()
@@ -0,0 +1,72 @@
+package bitcoin
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+const (
+	// ReceiveChain is the BIP32 chain index used for receive addresses
+	ReceiveChain uint32 = 0
+	// ChangeChain is the BIP32 chain index used for change addresses
+	ChangeChain uint32 = 1
+)
+
+// ErrPrivateExtendedKey is returned when a private extended key is given where only
+// an extended public key is expected, we never want to hold private keys for watch-only wallets
+var ErrPrivateExtendedKey = errors.New("extended private key is not accepted, please provide an extended public key")
+
+// DeriveAddressesFromXpub derives qty addresses starting from index start on the given chain
+// (ReceiveChain or ChangeChain) of an account level extended public key, e.g. m/44'/0'/0'.
+func DeriveAddressesFromXpub(xpub string, chain uint32, start, qty int) ([]string, error) {
+	if qty < 0 || start < 0 {
+		return nil, fmt.Errorf("invalid derivation range [%d, %d)", start, start+qty)
+	}
+
+	key, err := hdkeychain.NewKeyFromString(xpub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extended public key: %v", err)
+	}
+
+	if key.IsPrivate() {
+		return nil, ErrPrivateExtendedKey
+	}
+
+	if !key.IsForNet(&chaincfg.MainNetParams) {
+		return nil, errors.New("extended public key is not for bitcoin main net")
+	}
+
+	chainKey, err := key.Child(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, qty)
+	// a tiny fraction of indexes produce invalid keys, BIP32 says to skip them, the next indexes
+	// are used instead so that qty addresses are always returned
+	for i := start; len(addrs) < qty; i++ {
+		if int64(i) >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("no more non-hardened index after %d", start)
+		}
+
+		child, err := chainKey.Child(uint32(i))
+		if err != nil {
+			if err == hdkeychain.ErrInvalidChild {
+				continue
+			}
+			return nil, err
+		}
+
+		addr, err := child.Address(&chaincfg.MainNetParams)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs = append(addrs, addr.EncodeAddress())
+	}
+
+	return addrs, nil
+}
@@ -0,0 +1,47 @@
+package bitcoin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// account key m/44'/0'/0' of the BIP39 mnemonic "abandon abandon ... about", whose addresses are
+// used as test vectors by most wallets
+const testAccountXpub = "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"
+
+func TestDeriveAddressesFromXpub(t *testing.T) {
+	addrs, err := DeriveAddressesFromXpub(testAccountXpub, ReceiveChain, 0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", "1Ak8PffB2meyfYnbXZR9EGfLfFZVpzJvQP"}, addrs)
+
+	addrs, err = DeriveAddressesFromXpub(testAccountXpub, ChangeChain, 0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1J3J6EvPrv8q6AC3VCjWV45Uf3nssNMRtH", "13vKxXzHXXd8HquAYdpkJoi9ULVXUgfpS5"}, addrs)
+
+	addrs, err = DeriveAddressesFromXpub(testAccountXpub, ReceiveChain, 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1Ak8PffB2meyfYnbXZR9EGfLfFZVpzJvQP"}, addrs)
+
+	addrs, err = DeriveAddressesFromXpub(testAccountXpub, ReceiveChain, 0, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, addrs)
+
+	_, err = DeriveAddressesFromXpub(testAccountXpub, ReceiveChain, -1, 1)
+	assert.NotNil(t, err)
+}
+
+func TestDeriveAddressesFromXpubInvalidKeys(t *testing.T) {
+	// BIP32 test vector 1, master keys
+	xprv := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+	tpub := "tpubD6NzVbkrYhZ4XgiXtGrdW5XDAPFCL9h7we1vwNCpn8tGbBcgfVYjXyhWo4E1xkh56hjod1RhGjxbaTLV3X4FyWuejifB9jusQ46QzG87VKp"
+
+	_, err := DeriveAddressesFromXpub(xprv, ReceiveChain, 0, 1)
+	assert.Equal(t, ErrPrivateExtendedKey, err)
+
+	_, err = DeriveAddressesFromXpub(tpub, ReceiveChain, 0, 1)
+	assert.NotNil(t, err)
+
+	_, err = DeriveAddressesFromXpub("xpub-invalid", ReceiveChain, 0, 1)
+	assert.NotNil(t, err)
+}
@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"reflect"
 	"strings"
@@ -85,7 +84,10 @@ func NewTransaction(utxos interface{}, outAddrs []TxOut) (*Transaction, error) {
 		if err != nil {
 			return nil, fmt.Errorf("decode address %s, faild, %s", out.Addr, err)
 		}
-		txout := createTxOut(out.Value, addr)
+		txout, err := createTxOut(out.Value, addr)
+		if err != nil {
+			return nil, err
+		}
 		tx.AddTxOut(txout)
 	}
 
@@ -199,6 +201,9 @@ func lookupTxid(hash *chainhash.Hash) (*blockChainInfoTx, error) {
 // To generate a new valid transaction all of the parameters of the TxOut we are
 // spending from must be used.
 func getFundingParams(rawtx *blockChainInfoTx, vout uint32) (*wire.TxOut, *wire.OutPoint, error) {
+	if int(vout) >= len(rawtx.Outputs) {
+		return nil, nil, fmt.Errorf("output %d not found in transaction %s", vout, rawtx.Hash)
+	}
 	blkChnTxOut := rawtx.Outputs[vout]
 
 	hash, err := chainhash.NewHashFromStr(rawtx.Hash)
@@ -230,14 +235,14 @@ func createTxIn(outpoint *wire.OutPoint) *wire.TxIn {
 }
 
 // createTxOut generates a TxOut that can be added to a transaction.
-func createTxOut(outCoins uint64, addr btcutil.Address) *wire.TxOut {
+func createTxOut(outCoins uint64, addr btcutil.Address) (*wire.TxOut, error) {
 	// Take the address and generate a PubKeyScript out of it
 	script, err := txscript.PayToAddrScript(addr)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	txout := wire.NewTxOut(int64(outCoins), script)
-	return txout
+	return txout, nil
 }
 
 func (tx *Transaction) Serialize() ([]byte, error) {
@@ -49,12 +49,12 @@ func (eum *ExUtxoManager) Start(closing chan bool) {
 			// check bitcoin new utxos.
 			newUtxos, err := eum.checkNewUtxo()
 			if err != nil {
-				logger.Error(err.Error())
+				logger.Error(err)
 				break
 			}
 
 			for _, utxo := range newUtxos {
-				logger.Debug("new bitcoin utxo: txid:%s void:%d amt:%d", utxo.GetTxid(), utxo.GetVout(), utxo.GetAmount())
+				logger.Debugf("new bitcoin utxo: txid:%s void:%d amt:%d", utxo.GetTxid(), utxo.GetVout(), utxo.GetAmount())
 				eum.UtxosCh <- utxo
 			}
 		}
@@ -66,7 +66,7 @@ func (eum *ExUtxoManager) GetUtxo() chan Utxo {
 }
 
 func (eum *ExUtxoManager) PutUtxo(utxo Utxo) {
-	logger.Debug("bitcoin utxo put back: addr:%s txid:%s vout:%d",
+	logger.Debugf("bitcoin utxo put back: addr:%s txid:%s vout:%d",
 		utxo.GetAddress(), utxo.GetTxid(), utxo.GetVout())
 	eum.UtxosCh <- utxo
 }
@@ -104,14 +104,14 @@ func (eum *ExUtxoManager) checkNewUtxo() ([]Utxo, error) {
 // the utxos got before will put back to the utxos pool, and return error.
 // the tm is millisecond
 func (eum *ExUtxoManager) chooseUtxos(amount uint64, tm time.Duration) ([]Utxo, error) {
-	logger.Debug("bitcoin choose utxos, amount:%d", amount)
+	logger.Debugf("bitcoin choose utxos, amount:%d", amount)
 	var totalAmount uint64
 	// utxos := []bitcoin.UtxoWithkey{}
 	utxos := []Utxo{}
 	for {
 		select {
 		case utxo := <-eum.UtxosCh:
-			logger.Debug("get utxo: addr:%s amt:%d", utxo.GetAddress(), utxo.GetAmount())
+			logger.Debugf("get utxo: addr:%s amt:%d", utxo.GetAddress(), utxo.GetAmount())
 			utxos = append(utxos, utxo)
 			totalAmount += utxo.GetAmount()
 			if totalAmount >= amount {
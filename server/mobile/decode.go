@@ -0,0 +1,125 @@
+package mobile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/hankgao/superwallet-server/server/internal/txdecode"
+	"github.com/hankgao/superwallet-server/server/mobile/bitcoin"
+	log "github.com/sirupsen/logrus"
+)
+
+// DecodeRawTransaction returns a normalized view of a raw transaction in JSON format, see
+// DecodedTransaction, i.e, to show the user what is about to be sent. The transaction is decoded
+// locally, input owners and amounts are looked up on the server for skycoin forks and on
+// blockchain.info for bitcoin, they are left empty when the lookup fails
+func DecodeRawTransaction(coinType, rawtx string) (string, error) {
+	var dt *DecodedTransaction
+	var err error
+	if coinType == "bitcoin" {
+		dt, err = decodeBitcoinTransaction(rawtx)
+	} else {
+		dt, err = txdecode.Skycoin(coinType, rawtx)
+		if err == nil {
+			if full, err := serverDecodeTransaction(coinType, rawtx); err != nil {
+				log.Warnf("failed to look up inputs of transaction %s: %v", dt.Txid, err)
+			} else {
+				dt = full
+			}
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.MarshalIndent(dt, "", "    ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// serverDecodeTransaction asks the server to decode a transaction, which looks up its inputs on the node
+func serverDecodeTransaction(coinType, rawtx string) (*DecodedTransaction, error) {
+	body, err := json.Marshal(struct {
+		Rawtx string `json:"rawtx"`
+	}{
+		Rawtx: rawtx,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("%s/%s/%s", superwalletServer, coinType, DECODE_TRANSACTION)
+	resp, err := httpClient.Post(path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, b)
+	}
+
+	var dt DecodedTransaction
+	if err := json.Unmarshal(b, &dt); err != nil {
+		return nil, err
+	}
+	return &dt, nil
+}
+
+func decodeBitcoinTransaction(rawtx string) (*DecodedTransaction, error) {
+	tx, err := bitcoin.DecodeTx(rawtx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	dt := &DecodedTransaction{
+		CoinType: "bitcoin",
+		Txid:     tx.Txid,
+		Size:     tx.Size,
+		Inputs:   []DecodedInput{},
+		Outputs:  []DecodedOutput{},
+	}
+
+	var in, out int64
+	inputsKnown := true
+	for _, i := range tx.Inputs {
+		di := DecodedInput{
+			ID:      fmt.Sprintf("%s:%d", i.Txid, i.Vout),
+			Address: i.Address,
+		}
+		if i.Value < 0 {
+			inputsKnown = false
+		} else {
+			di.Amount = bitcoin.FormatBTC(i.Value)
+			in += i.Value
+		}
+		dt.Inputs = append(dt.Inputs, di)
+	}
+
+	for _, o := range tx.Outputs {
+		dt.Outputs = append(dt.Outputs, DecodedOutput{
+			Address: o.Address,
+			Amount:  bitcoin.FormatBTC(o.Value),
+		})
+		out += o.Value
+	}
+
+	dt.OutputAmount = bitcoin.FormatBTC(out)
+	if inputsKnown {
+		dt.InputAmount = bitcoin.FormatBTC(in)
+		dt.Fee = bitcoin.FormatBTC(in - out)
+	}
+
+	return dt, nil
+}
@@ -0,0 +1,65 @@
+package mobile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// RegisterPushNotifications asks the server to notify the device when payments to addrs are confirmed.
+// platform is apns or fcm, addrs is a comma separated list replacing the addresses previously
+// registered for coinType, an empty list stops notifications for coinType
+func RegisterPushNotifications(token, platform, coinType, addrs string) error {
+	b, err := json.Marshal(struct {
+		Token    string   `json:"token"`
+		Platform string   `json:"platform"`
+		CoinType string   `json:"coinType"`
+		Addrs    []string `json:"addrs"`
+	}{
+		Token:    token,
+		Platform: platform,
+		CoinType: coinType,
+		Addrs:    splitAddresses(addrs),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/%s", superwalletServer, SUBSCRIPTIONS), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return doRequest(req)
+}
+
+// UnregisterPushNotifications stops all notifications to the device, i.e, when the user logs out
+func UnregisterPushNotifications(token string) error {
+	path := fmt.Sprintf("%s/%s?token=%s", superwalletServer, SUBSCRIPTIONS, url.QueryEscape(token))
+
+	req, err := http.NewRequest("DELETE", path, nil)
+	if err != nil {
+		return err
+	}
+
+	return doRequest(req)
+}
+
+// doRequest sends a request whose response has no content, errors of the server are returned
+func doRequest(req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return nil
+}
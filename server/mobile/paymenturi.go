@@ -0,0 +1,132 @@
+package mobile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// EncodePaymentURI builds a payment request URI, the scheme is the coin type, e.g,
+// skycoin:ADDR?amount=1.5&hours=10&label=shop for skycoin based coins and a BIP21 URI for bitcoin.
+// Empty amount, hours, label and message are omitted. The coin type is bitcoin or one of the
+// supported coins, see SetCoinTypes
+func EncodePaymentURI(coinType, address, amount, hours, label, message string) (string, error) {
+	pr := PaymentRequest{
+		CoinType: coinType,
+		Address:  address,
+		Amount:   amount,
+		Hours:    hours,
+		Label:    label,
+		Message:  message,
+	}
+
+	if err := pr.validate(); err != nil {
+		return "", err
+	}
+
+	// keep parameters in a stable order, url.Values would sort them
+	var params []string
+	add := func(k, v string) {
+		if v != "" {
+			// BIP21 expects %20 rather than + for spaces
+			params = append(params, k+"="+strings.Replace(url.QueryEscape(v), "+", "%20", -1))
+		}
+	}
+	add("amount", pr.Amount)
+	add("hours", pr.Hours)
+	add("label", pr.Label)
+	add("message", pr.Message)
+
+	uri := fmt.Sprintf("%s:%s", pr.CoinType, pr.Address)
+	if len(params) > 0 {
+		uri += "?" + strings.Join(params, "&")
+	}
+
+	return uri, nil
+}
+
+// ParsePaymentURI parses a payment request URI and returns a PaymentRequest in JSON format,
+// which the app can use to prefill the send form. URIs whose scheme is not a known coin type,
+// e.g, mailto:, are rejected
+func ParsePaymentURI(uri string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return "", fmt.Errorf("invalid payment uri: %v", err)
+	}
+
+	if u.Scheme == "" {
+		return "", errors.New("invalid payment uri: missing scheme")
+	}
+
+	// some wallets produce bitcoin://ADDR instead of bitcoin:ADDR
+	address := u.Opaque
+	if address == "" {
+		address = u.Host
+	}
+
+	values, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return "", fmt.Errorf("invalid payment uri parameters: %v", err)
+	}
+
+	pr := PaymentRequest{
+		CoinType: strings.ToLower(u.Scheme),
+		Address:  address,
+		Amount:   values.Get("amount"),
+		Hours:    values.Get("hours"),
+		Label:    values.Get("label"),
+		Message:  values.Get("message"),
+	}
+
+	// BIP21: required parameters we don't understand make the uri invalid
+	for k := range values {
+		if strings.HasPrefix(k, "req-") {
+			return "", fmt.Errorf("unsupported required parameter %s", k)
+		}
+	}
+
+	if err := pr.validate(); err != nil {
+		return "", err
+	}
+
+	jsonBytes, err := json.MarshalIndent(pr, "", "    ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonBytes), nil
+}
+
+func (pr PaymentRequest) validate() error {
+	if pr.CoinType == "" {
+		return errors.New("coin type is empty")
+	}
+
+	if !isKnownCoinType(pr.CoinType) {
+		return fmt.Errorf("%s is not a supported coin type", pr.CoinType)
+	}
+
+	if err := ValidateAddress(pr.CoinType, pr.Address); err != nil {
+		return err
+	}
+
+	if pr.Amount != "" {
+		if err := ValidateAmount(pr.CoinType, pr.Amount); err != nil {
+			return err
+		}
+	}
+
+	if pr.Hours != "" {
+		if pr.CoinType == "bitcoin" {
+			return errors.New("bitcoin has no coin hours")
+		}
+		if _, err := strconv.ParseUint(pr.Hours, 10, 64); err != nil {
+			return fmt.Errorf("invalid hours %s", pr.Hours)
+		}
+	}
+
+	return nil
+}
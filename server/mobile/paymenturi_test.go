@@ -0,0 +1,87 @@
+package mobile
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+func TestPaymentURIRoundTrip(t *testing.T) {
+	SetCoinTypes("skycoin,mzcoin")
+	defer SetCoinTypes("")
+
+	pub, _ := cipher.GenerateKeyPair()
+	addr := cipher.AddressFromPubKey(pub).String()
+
+	uri, err := EncodePaymentURI("mzcoin", addr, "1.5", "10", "coffee & cake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "mzcoin:" + addr + "?amount=1.5&hours=10&label=coffee%20%26%20cake"
+	if uri != expect {
+		t.Fatalf("expected %s, got %s", expect, uri)
+	}
+
+	s, err := ParsePaymentURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr := PaymentRequest{}
+	if err := json.Unmarshal([]byte(s), &pr); err != nil {
+		t.Fatal(err)
+	}
+
+	if pr.CoinType != "mzcoin" || pr.Address != addr || pr.Amount != "1.5" || pr.Hours != "10" || pr.Label != "coffee & cake" {
+		t.Fatalf("unexpected payment request %+v", pr)
+	}
+}
+
+func TestParsePaymentURIInvalid(t *testing.T) {
+	SetCoinTypes("skycoin,mzcoin")
+	defer SetCoinTypes("")
+
+	pub, _ := cipher.GenerateKeyPair()
+	addr := cipher.AddressFromPubKey(pub).String()
+
+	uris := []string{
+		"skycoin:" + addr + "?amount=1.0001",
+		"skycoin:" + addr + "?hours=-1",
+		"skycoin:notanaddress",
+		"bitcoin:19EC57DDAtTCVcKENVcd5tbRXk7yKSKvGK?hours=1",
+		"bitcoin:19EC57DDAtTCVcKENVcd5tbRXk7yKSKvGK?req-somethingyoudontunderstand=50",
+		addr,
+		"mailto:" + addr,
+		"shellcoin:" + addr,
+	}
+
+	for _, uri := range uris {
+		if _, err := ParsePaymentURI(uri); err == nil {
+			t.Errorf("%s should be invalid", uri)
+		}
+	}
+}
+
+func TestPaymentURIUnknownCoinType(t *testing.T) {
+	SetCoinTypes("skycoin")
+	defer SetCoinTypes("")
+
+	pub, _ := cipher.GenerateKeyPair()
+	addr := cipher.AddressFromPubKey(pub).String()
+
+	if _, err := ParsePaymentURI("mailto:" + addr); err == nil || err.Error() != "mailto is not a supported coin type" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := EncodePaymentURI("mailto", addr, "", "", "", ""); err == nil {
+		t.Fatal("mailto should not be encoded")
+	}
+
+	if _, err := ParsePaymentURI("SKYCOIN:" + addr); err != nil {
+		t.Fatalf("scheme should be case insensitive, got %v", err)
+	}
+	if _, err := ParsePaymentURI("bitcoin:19EC57DDAtTCVcKENVcd5tbRXk7yKSKvGK?amount=0.1"); err != nil {
+		t.Fatalf("bitcoin is always known, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package mobile
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrCertificateNotPinned is returned when the server doesn't present any of the pinned certificates
+var ErrCertificateNotPinned = errors.New("server certificate doesn't match any pinned certificate")
+
+// SetPinnedCertificates pins the public keys superwallet server may present. pins is a comma separated
+// list of base64 encoded SHA-256 hashes of the certificates' SubjectPublicKeyInfo, the same format as HPKP, e.g,
+// openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+// Pinning the key of the intermediate CA as a backup is recommended. An empty pins removes pinning.
+// It should be called before any other function of this package
+func SetPinnedCertificates(pins string) error {
+	pinned := make(map[string]struct{})
+	for _, p := range strings.Split(pins, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		b, err := base64.StdEncoding.DecodeString(p)
+		if err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("invalid pin %s, a base64 encoded SHA-256 hash is expected", p)
+		}
+		pinned[p] = struct{}{}
+	}
+
+	if len(pinned) == 0 {
+		httpClient = newHTTPClient(nil)
+		return nil
+	}
+
+	httpClient = newHTTPClient(&tls.Config{
+		// called after the normal certificate verification succeeded
+		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			for _, chain := range verifiedChains {
+				for _, cert := range chain {
+					h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+					if _, ok := pinned[base64.StdEncoding.EncodeToString(h[:])]; ok {
+						return nil
+					}
+				}
+			}
+			return ErrCertificateNotPinned
+		},
+	})
+
+	return nil
+}
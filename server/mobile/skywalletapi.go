@@ -2,8 +2,11 @@ package mobile
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
@@ -12,6 +15,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hankgao/superwallet-server/server/mobile/bitcoin"
@@ -26,7 +30,7 @@ import (
 var httpClient http.Client
 
 const (
-	packageVersion                    = "1.0.2"
+	packageVersion                    = "1.1.0"
 	dialTimeout         time.Duration = 60 * time.Second
 	tlsHandshakeTimeout time.Duration = 60 * time.Second
 	httpClientTimeout   time.Duration = 120 * time.Second
@@ -34,26 +38,179 @@ const (
 
 	GET_SUPPORTED_COINS = "getSupportedCoins"
 	GET_BALANCE         = "getBalance"
+	GET_BALANCES        = "balances"
 	GET_OUTPUTS         = "getOutputs"
 	INJECT_TRANSACTION  = "injectTransaction"
 	GET_TRANSACTION     = "transaction"
+	GET_TX_STATUS       = "txStatus"
+	DECODE_TRANSACTION  = "decodeTransaction"
+	GET_TRANSACTIONS    = "getTransactions"
+	GET_PRICES          = "prices"
+	SUBSCRIPTIONS       = "subscriptions"
+	STREAM              = "stream"
+
+	apiVersionHeader = "X-Superwallet-Api-Version"
+	requestIDHeader  = "X-Request-Id"
+	apiKeyHeader     = "X-Api-Key"
+
+	idempotencyKeyHeader = "Idempotency-Key"
 )
 
 var superwalletServer = "http://127.0.0.1:6789"
 
 func init() {
+	httpClient = newHTTPClient(nil)
+
+	log.SetLevel(log.InfoLevel)
+}
+
+// newHTTPClient returns the client used to talk to superwallet server, tlsConfig can be nil
+func newHTTPClient(tlsConfig *tls.Config) http.Client {
 	transport := &http.Transport{
 		Dial: (&net.Dialer{
 			Timeout: dialTimeout,
 		}).Dial,
 		TLSHandshakeTimeout: tlsHandshakeTimeout,
+		TLSClientConfig:     tlsConfig,
 	}
-	httpClient = http.Client{
-		Transport: transport,
+	return http.Client{
+		Transport: versionTransport{transport},
 		Timeout:   httpClientTimeout,
 	}
+}
 
-	log.SetLevel(log.InfoLevel)
+// versionTransport tells the server which API version this package implements,
+// so that the server can reject or adapt requests from outdated app builds, it
+// also tags each request with a request ID that shows up in the server logs and
+// with the API key set by SetAPIKey
+type versionTransport struct {
+	base http.RoundTripper
+}
+
+func (vt versionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request
+	r := req.WithContext(req.Context())
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set(apiVersionHeader, packageVersion)
+
+	id := r.Header.Get(requestIDHeader)
+	if id == "" {
+		id = newRequestID()
+		r.Header.Set(requestIDHeader, id)
+	}
+	setLastRequestID(id)
+
+	if key := getAPIKey(); key != "" {
+		r.Header.Set(apiKeyHeader, key)
+	}
+
+	if lang := getLanguage(); lang != "" && r.Header.Get("Accept-Language") == "" {
+		r.Header.Set("Accept-Language", lang)
+	}
+
+	resp, err := vt.base.RoundTrip(r)
+	if err != nil {
+		log.WithField("request_id", id).Errorf("request to %s failed: %s", r.URL.Path, err)
+	}
+	return resp, err
+}
+
+var apiKey struct {
+	sync.Mutex
+	key string
+}
+
+// SetAPIKey sets the API key sent with every request, servers with API key authentication
+// enabled reject requests without one, an empty key stops sending it
+func SetAPIKey(key string) {
+	apiKey.Lock()
+	apiKey.key = key
+	apiKey.Unlock()
+}
+
+func getAPIKey() string {
+	apiKey.Lock()
+	defer apiKey.Unlock()
+	return apiKey.key
+}
+
+var language struct {
+	sync.Mutex
+	lang string
+}
+
+// SetLanguage sets the preferred languages of the app, in Accept-Language format, e.g, "zh-CN,en;q=0.8",
+// the server uses it to fill the displayName of coins
+func SetLanguage(lang string) {
+	language.Lock()
+	language.lang = lang
+	language.Unlock()
+}
+
+func getLanguage() string {
+	language.Lock()
+	defer language.Unlock()
+	return language.lang
+}
+
+var coinTypes struct {
+	sync.Mutex
+	types map[string]bool
+}
+
+// SetCoinTypes sets the comma separated coin types payment URIs may have as scheme, besides bitcoin.
+// GetSupportedCoins sets them to the coins of the server
+func SetCoinTypes(types string) {
+	m := make(map[string]bool)
+	for _, t := range strings.Split(types, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			m[t] = true
+		}
+	}
+
+	coinTypes.Lock()
+	coinTypes.types = m
+	coinTypes.Unlock()
+}
+
+func isKnownCoinType(coinType string) bool {
+	if coinType == "bitcoin" {
+		return true
+	}
+
+	coinTypes.Lock()
+	defer coinTypes.Unlock()
+	return coinTypes.types[coinType]
+}
+
+var lastRequestID struct {
+	sync.Mutex
+	id string
+}
+
+func setLastRequestID(id string) {
+	lastRequestID.Lock()
+	lastRequestID.id = id
+	lastRequestID.Unlock()
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// LastRequestID returns the request ID of the last request sent to the server,
+// apps can show it in error reports so that they can be matched with the server logs
+func LastRequestID() string {
+	lastRequestID.Lock()
+	defer lastRequestID.Unlock()
+	return lastRequestID.id
 }
 
 // SetServer allows client to change back-end server, for example, for testing purpose
@@ -66,7 +223,8 @@ func GetApiVersion() string {
 	return packageVersion
 }
 
-// GetSupportedCoins returns a list of coins that are currently supported, in JSON format
+// GetSupportedCoins returns a list of coins that are currently supported, in JSON format,
+// sorted by display order, see CoinMeta
 func GetSupportedCoins() (string, error) {
 	path := fmt.Sprintf("%s/%s", superwalletServer, GET_SUPPORTED_COINS)
 	r, err := httpClient.Get(path)
@@ -82,9 +240,41 @@ func GetSupportedCoins() (string, error) {
 		return "", err
 	}
 
+	var cms CoinMetas
+	if r.StatusCode == http.StatusOK && json.Unmarshal(rawBytes, &cms) == nil {
+		names := make([]string, len(cms))
+		for i, cm := range cms {
+			names[i] = cm.NameInEnglish
+		}
+		SetCoinTypes(strings.Join(names, ","))
+	}
+
 	return string(rawBytes), nil
 }
 
+// GetPrices returns the prices of coins in fiat currencies, in JSON format, see Price.
+// symbols and fiats are comma separated, e.g, "SKY,MZC" and "CNY", empty means all of them
+func GetPrices(symbols, fiats string) (string, error) {
+	path := fmt.Sprintf("%s/%s", superwalletServer, GET_PRICES)
+
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	q := req.URL.Query()
+	if symbols != "" {
+		q.Add("symbols", symbols)
+	}
+	if fiats != "" {
+		q.Add("fiat", fiats)
+	}
+
+	req.URL.RawQuery = q.Encode()
+
+	return httpGet(req.URL.String())
+}
+
 // NewSeed returns a randomly generated seed which is unique globally
 func NewSeed() (string, error) {
 	// TODO: support 256 bits in the future
@@ -155,6 +345,32 @@ func GenerateNewAddresses(coinType, lastSeed string, qty int) (string, error) {
 
 // SendCoin sends coins from a list of addresses to a target address
 func SendCoin(coinType, inputAddresses, privateKeys, targetAddress string, amount float64) (string, error) {
+	return SendCoinWithIdempotencyKey(coinType, inputAddresses, privateKeys, targetAddress, amount, "")
+}
+
+// NewIdempotencyKey returns a key for SendCoinWithIdempotencyKey
+func NewIdempotencyKey() string {
+	return newRequestID()
+}
+
+// SendCoinWithIdempotencyKey is SendCoin which can safely be retried, i.e, after a timeout: the server
+// injects one transaction per key and returns the txid of the first call to later ones. The app keeps
+// the key of a payment, see NewIdempotencyKey, until it gets a txid or an error from the server
+func SendCoinWithIdempotencyKey(coinType, inputAddresses, privateKeys, targetAddress string, amount float64, idempotencyKey string) (string, error) {
+
+	for _, addr := range splitAddresses(inputAddresses) {
+		if isWatchOnlyAddress(coinType, addr) {
+			return "", ErrWatchOnly
+		}
+	}
+
+	if err := ValidateAddress(coinType, targetAddress); err != nil {
+		return "", err
+	}
+
+	if err := ValidateAmount(coinType, strconv.FormatFloat(amount, 'f', -1, 64)); err != nil {
+		return "", err
+	}
 
 	r, err := createRawTx(coinType, inputAddresses, privateKeys, targetAddress, amount)
 	if err != nil {
@@ -168,9 +384,21 @@ func SendCoin(coinType, inputAddresses, privateKeys, targetAddress string, amoun
 	}
 
 	rawBytes, err := json.MarshalIndent(rawtx, "", "    ")
+	if err != nil {
+		return "", err
+	}
 
 	url := fmt.Sprintf("%s/%s/%s", superwalletServer, coinType, INJECT_TRANSACTION)
-	resp, err := httpClient.Post(url, "application/json", bytes.NewBuffer(rawBytes))
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(rawBytes))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if idempotencyKey != "" {
+		req.Header.Set(idempotencyKeyHeader, idempotencyKey)
+	}
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -182,7 +410,7 @@ func SendCoin(coinType, inputAddresses, privateKeys, targetAddress string, amoun
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf(string(bodyBytes))
+		return "", errors.New(string(bodyBytes))
 	}
 
 	return string(bodyBytes), nil
@@ -198,6 +426,20 @@ func bitcoinGetBalance(addrs string) (string, error) {
 	return balance.String(), nil
 }
 
+func bitcoinGetOutputs(addrs string) (string, error) {
+	utxos, err := bitcoin.GetUnspentOutputs(strings.Split(addrs, ","))
+	if err != nil {
+		return "", err
+	}
+
+	jsonBytes, err := json.MarshalIndent(utxos, "", "    ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonBytes), nil
+}
+
 func bitcoinSendcoin() {
 
 }
@@ -227,11 +469,165 @@ func GetBalance(coinType, addresses string) (string, error) {
 	return httpGet(path)
 }
 
+// GetBalanceInFiat is GetBalance with the value of the balance in a fiat currency, e.g, CNY
+func GetBalanceInFiat(coinType, addresses, fiat string) (string, error) {
+	if coinType == "bitcoin" {
+		return "", fmt.Errorf("fiat balance is not supported for %s", coinType)
+	}
+
+	path := fmt.Sprintf("%s/%s/%s", superwalletServer, coinType, GET_BALANCE)
+
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	q := req.URL.Query()
+	q.Add("addrs", addresses)
+	q.Add("fiat", fiat)
+
+	req.URL.RawQuery = q.Encode()
+
+	return httpGet(req.URL.String())
+}
+
+// GetBalances returns balances of addresses of many coins at once, balances is JSON like
+// {"skycoin": ["addr1", "addr2"], "bitcoin": ["addr3"]}. The result is keyed by coin, each coin having
+// either its balance or an error, e.g, {"skycoin": {"balance": {...}}, "bitcoin": {"error": "..."}}.
+// Bitcoin balances are fetched by the app, like GetBalance does, they are {"amount": satoshis}
+func GetBalances(balances string) (string, error) {
+	var addrs map[string][]string
+	if err := json.Unmarshal([]byte(balances), &addrs); err != nil {
+		return "", fmt.Errorf("invalid balances: %v", err)
+	}
+
+	btcAddrs, withBitcoin := addrs["bitcoin"]
+	delete(addrs, "bitcoin")
+
+	var btcBalance json.RawMessage
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if withBitcoin {
+			btcBalance = bitcoinCoinBalance(btcAddrs)
+		}
+	}()
+
+	result := make(map[string]json.RawMessage)
+	if len(addrs) > 0 {
+		var err error
+		result, err = serverGetBalances(addrs)
+		if err != nil {
+			// the bitcoin balance is still worth returning, each server coin gets the error
+			result = make(map[string]json.RawMessage, len(addrs)+1)
+			for coinType := range addrs {
+				result[coinType], _ = json.Marshal(map[string]string{"error": err.Error()})
+			}
+		}
+	}
+
+	<-done
+	if withBitcoin {
+		result["bitcoin"] = btcBalance
+	}
+
+	jsonBytes, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonBytes), nil
+}
+
+// serverGetBalances gets balances of skycoin forks from the server, keyed by coin
+func serverGetBalances(addrs map[string][]string) (map[string]json.RawMessage, error) {
+	body, err := json.Marshal(addrs)
+	if err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("%s/%s", superwalletServer, GET_BALANCES)
+	req, err := http.NewRequest("POST", path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(string(bodyBytes))
+	}
+
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(bodyBytes, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// bitcoinCoinBalance returns the balance of bitcoin addresses in the format of a GetBalances coin
+func bitcoinCoinBalance(addrs []string) json.RawMessage {
+	cb := struct {
+		Balance interface{} `json:"balance,omitempty"`
+		Error   string      `json:"error,omitempty"`
+	}{}
+
+	b := bitcoin.Bitcoin{}
+	balance, err := b.GetBalance(addrs)
+	if err != nil {
+		cb.Error = err.Error()
+	} else {
+		cb.Balance = struct {
+			Amount uint64 `json:"amount"`
+		}{balance.GetAmount()}
+	}
+
+	jsonBytes, _ := json.Marshal(cb)
+	return jsonBytes
+}
+
 // GetOutputs is called by Send method as inputs to create a raw transtion, which is then be injected
 func GetOutputs(coinType, addrs string) (string, error) {
 	// check to see if coinType is bitcoin, if it is, then go to Bitcoin code
 	path := fmt.Sprintf("%s/%s/%s", superwalletServer, coinType, GET_OUTPUTS)
 
+	if coinType == "bitcoin" {
+		return bitcoinGetOutputs(addrs)
+	}
+
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	q := req.URL.Query()
+	q.Add("addrs", addrs)
+
+	req.URL.RawQuery = q.Encode()
+
+	path = req.URL.String()
+
+	return httpGet(path)
+}
+
+// GetAddressTransactions returns transaction history of a comma separated list of addresses
+func GetAddressTransactions(coinType, addrs string) (string, error) {
+	if coinType == "bitcoin" {
+		return bitcoin.GetTransactions(strings.Split(addrs, ","))
+	}
+
+	path := fmt.Sprintf("%s/%s/%s", superwalletServer, coinType, GET_TRANSACTIONS)
+
 	req, err := http.NewRequest("GET", path, nil)
 	if err != nil {
 		return "", err
@@ -268,6 +664,23 @@ func GetTransaction(coinType, txID string) (string, error) {
 	return httpGet(path)
 }
 
+// GetTransactionStatus returns the status of a transaction in JSON format, see TxStatus.
+// Transactions injected with InjectTransaction are rebroadcast by the server when they are dropped
+func GetTransactionStatus(coinType, txid string) (string, error) {
+	path := fmt.Sprintf("%s/%s/%s", superwalletServer, coinType, GET_TX_STATUS)
+
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return "", err
+	}
+
+	q := req.URL.Query()
+	q.Add("txid", txid)
+	req.URL.RawQuery = q.Encode()
+
+	return httpGet(req.URL.String())
+}
+
 func httpGet(path string) (string, error) {
 	r, err := httpClient.Get(path)
 	if err != nil {
@@ -309,6 +722,11 @@ func createRawTx(coinType, inputAddresses, privateKeys, targetAddress string, am
 		return "", err
 	}
 
+	targetAddr, err := cipher.DecodeBase58Address(targetAddress)
+	if err != nil {
+		return "", fmt.Errorf("invalid target address %s: %v", targetAddress, err)
+	}
+
 	// Step 1: get all spendable outputs as input
 	outputs, err := GetOutputs(coinType, inputAddresses)
 	if err != nil {
@@ -349,8 +767,23 @@ func createRawTx(coinType, inputAddresses, privateKeys, targetAddress string, am
 
 		inputHours += ux.CalculatedHours
 
-		tx.PushInput(cipher.MustSHA256FromHex(ux.Hash))
-		signKeys = append(signKeys, cipher.MustSecKeyFromHex(asm[ux.Address]))
+		uxHash, err := cipher.SHA256FromHex(ux.Hash)
+		if err != nil {
+			return "", fmt.Errorf("invalid output hash %s: %v", ux.Hash, err)
+		}
+
+		sk, ok := asm[ux.Address]
+		if !ok {
+			return "", fmt.Errorf("private key of address %s not found", ux.Address)
+		}
+
+		secKey, err := cipher.SecKeyFromHex(sk)
+		if err != nil {
+			return "", fmt.Errorf("invalid private key of address %s: %v", ux.Address, err)
+		}
+
+		tx.PushInput(uxHash)
+		signKeys = append(signKeys, secKey)
 
 		if inputDroplets >= droplets2Transfer {
 			break
@@ -361,11 +794,14 @@ func createRawTx(coinType, inputAddresses, privateKeys, targetAddress string, am
 
 	change := inputDroplets - droplets2Transfer
 	if change > 0 {
-		changeAddr := o[0].Address // use address of the first ux as change address
-		tx.PushOutput(cipher.MustDecodeBase58Address(changeAddr), change, inputHours*9/10)
+		changeAddr, err := cipher.DecodeBase58Address(o[0].Address) // use address of the first ux as change address
+		if err != nil {
+			return "", fmt.Errorf("invalid change address %s: %v", o[0].Address, err)
+		}
+		tx.PushOutput(changeAddr, change, inputHours*9/10)
 	}
 
-	tx.PushOutput(cipher.MustDecodeBase58Address(targetAddress), droplets2Transfer, inputHours/10)
+	tx.PushOutput(targetAddr, droplets2Transfer, inputHours/10)
 
 	tx.SignInputs(signKeys)
 
@@ -1,6 +1,11 @@
 package mobile
 
-import "testing"
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
 
 func TestGetSupportedCoins(t *testing.T) {
 	_, err := GetSupportedCoins()
@@ -8,3 +13,46 @@ func TestGetSupportedCoins(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestGetBalances(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got map[string][]string
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil || got["mzcoin"] == nil {
+			http.Error(w, "100% invalid", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"skycoin": {"balance": {"confirmed": {"coins": 1}}}, "mzcoin": {"error": "missing addrs"}}`))
+	}))
+	defer srv.Close()
+
+	defer func(s string) {
+		superwalletServer = s
+	}(superwalletServer)
+	superwalletServer = srv.URL
+
+	s, err := GetBalances(`{"skycoin": ["a"], "mzcoin": []}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var balances map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &balances); err != nil {
+		t.Fatal(err)
+	}
+	if balances["skycoin"]["balance"] == nil || balances["mzcoin"]["error"] != "missing addrs" {
+		t.Errorf("unexpected balances %s", s)
+	}
+
+	// a failed request is an error of each coin, the body of the error is not a format string
+	s, err = GetBalances(`{"skycoin": ["a"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	balances = nil
+	if err := json.Unmarshal([]byte(s), &balances); err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances["skycoin"]["error"] != "100% invalid\n" {
+		t.Errorf("unexpected balances %s", s)
+	}
+}
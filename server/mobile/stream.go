@@ -0,0 +1,174 @@
+package mobile
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// streamRetryDelay is how long a stream waits before reconnecting after it was disconnected
+const streamRetryDelay = 5 * time.Second
+
+// StreamListener receives the events of a stream, it is implemented by the app.
+// eventType is unconfirmed, confirmed or balance, data is the event as JSON, e.g,
+// {"type":"confirmed","coinType":"skycoin","txid":"...","address":"...","coins":"1.000000","hours":10,"blockSeq":123}
+type StreamListener interface {
+	OnEvent(eventType, data string)
+	OnError(message string)
+}
+
+// Stream is an open stream of events about addresses, see OpenStream
+type Stream struct {
+	path     string
+	listener StreamListener
+
+	mu     sync.Mutex
+	resp   *http.Response
+	closed bool
+	done   chan struct{}
+}
+
+// OpenStream streams events about addresses of a coin to listener until Close is called,
+// addrs is a comma separated list. The stream reconnects by itself when the connection is lost,
+// OnError tells the app about it
+func OpenStream(coinType, addrs string, listener StreamListener) (*Stream, error) {
+	if len(splitAddresses(addrs)) == 0 {
+		return nil, fmt.Errorf("no addresses")
+	}
+
+	s := &Stream{
+		path:     fmt.Sprintf("%s/%s/%s?addrs=%s", superwalletServer, coinType, STREAM, url.QueryEscape(addrs)),
+		listener: listener,
+		done:     make(chan struct{}),
+	}
+
+	// errors of the first connection are returned, i.e, the coin is not supported
+	resp, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	go s.run(resp)
+
+	return s, nil
+}
+
+// Close ends the stream, no events are received afterwards
+func (s *Stream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.done)
+
+	if s.resp != nil {
+		s.resp.Body.Close()
+	}
+}
+
+func (s *Stream) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Stream) connect() (*http.Response, error) {
+	// the stream stays open, only dialing and the TLS handshake are limited
+	client := httpClient
+	client.Timeout = 0
+
+	req, err := http.NewRequest("GET", s.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		resp.Body.Close()
+		return nil, fmt.Errorf("stream is closed")
+	}
+	s.resp = resp
+
+	return resp, nil
+}
+
+// run reads events until the stream is closed, reconnecting when the connection is lost
+func (s *Stream) run(resp *http.Response) {
+	for {
+		err := s.read(resp)
+		if s.isClosed() {
+			return
+		}
+		s.listener.OnError(fmt.Sprintf("stream disconnected: %v", err))
+
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-time.After(streamRetryDelay):
+			}
+
+			resp, err = s.connect()
+			if err == nil {
+				break
+			}
+			if s.isClosed() {
+				return
+			}
+			s.listener.OnError(fmt.Sprintf("failed to reconnect stream: %v", err))
+		}
+	}
+}
+
+// read parses server-sent events, comments (i.e, heartbeats) are skipped
+func (s *Stream) read(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	var eventType, data string
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data != "" && !s.isClosed() {
+				s.listener.OnEvent(eventType, data)
+			}
+			eventType, data = "", ""
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data != "" {
+				data += "\n"
+			}
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("stream ended")
+}
@@ -1,5 +1,7 @@
 package mobile
 
+import "github.com/hankgao/superwallet-server/server/internal/txdecode"
+
 // AddressEntry represents the wallet address
 type AddressEntry struct {
 	Address string `json:"address"`
@@ -15,13 +17,80 @@ type NewAddressesResult struct {
 
 // CoinMeta represents a structure that holds metadata for a certain coin type
 type CoinMeta struct {
-	NameInChinese    string `json:"nameInChinese"`
-	NameInEnglish    string `json:"nameInEnglish"`
-	Symbol           string `json:"symbol"`
-	LogoURL          string `json:"logoURL"`
-	WebInterfacePort string `json:"webInterfacePort"`
-	NodeVersion      string `json:"nodeVersion"`
+	NameInChinese      string            `json:"nameInChinese"`
+	NameInEnglish      string            `json:"nameInEnglish"`
+	LocalizedNames     map[string]string `json:"localizedNames,omitempty"` // keyed by language tag, e.g, "ja" or "zh-TW"
+	DisplayName        string            `json:"displayName,omitempty"`    // set by the server from the Accept-Language header
+	Symbol             string            `json:"symbol"`
+	Description        string            `json:"description,omitempty"`
+	LogoURL            string            `json:"logoURL"`
+	WebInterfacePort   string            `json:"webInterfacePort"`
+	NodeVersion        string            `json:"nodeVersion"`
+	Decimals           int               `json:"decimals"`
+	CoinHours          bool              `json:"coinHours"` // whether the coin has coin hours, i.e, skycoin forks
+	MinSendAmount      string            `json:"minSendAmount,omitempty"`
+	ExplorerTxURL      string            `json:"explorerTxURL,omitempty"`      // e.g, https://explorer.skycoin.net/app/transaction/{txid}
+	ExplorerAddressURL string            `json:"explorerAddressURL,omitempty"` // e.g, https://explorer.skycoin.net/app/address/{address}
+	DisplayOrder       int               `json:"displayOrder"`
+	Maintenance        bool              `json:"maintenance,omitempty"`  // listed, but transactions can't be injected
+	Degraded           bool              `json:"degraded,omitempty"`     // set by the server when the node of the coin is down
+	Incompatible       bool              `json:"incompatible,omitempty"` // set by the server when the node version doesn't match NodeVersion
+	Disabled           bool              `json:"disabled,omitempty"`     // disabled coins are kept in the config file but not served
+}
+
+// Price represents the price of a coin in a fiat currency
+type Price struct {
+	Symbol    string  `json:"symbol"`
+	Fiat      string  `json:"fiat"`
+	Price     float64 `json:"price"`
+	Source    string  `json:"source"`
+	UpdatedAt int64   `json:"updatedAt"` // unix time
 }
 
+// TxStatus represents the status of a transaction, see GetTransactionStatus. Status is one of
+// submitted, pending (in the pool of unconfirmed transactions), confirmed, dropped (fell out of
+// the pool, it is rebroadcast), failed or unknown
+type TxStatus struct {
+	CoinType      string `json:"coinType"`
+	Txid          string `json:"txid"`
+	Status        string `json:"status"`
+	Confirmations int64  `json:"confirmations"`
+	BlockSeq      int64  `json:"blockSeq,omitempty"`
+	Tracked       bool   `json:"tracked"` // injected through the server, which rebroadcasts it when dropped
+	Rebroadcasts  int    `json:"rebroadcasts,omitempty"`
+	Error         string `json:"error,omitempty"`
+	SubmittedAt   int64  `json:"submittedAt,omitempty"` // unix time
+	UpdatedAt     int64  `json:"updatedAt"`             // unix time
+}
+
+// DecodedTransaction is a normalized view of a raw transaction, see DecodeRawTransaction
+type DecodedTransaction = txdecode.Transaction
+
+// DecodedInput is an input of a DecodedTransaction
+type DecodedInput = txdecode.Input
+
+// DecodedOutput is an output of a DecodedTransaction
+type DecodedOutput = txdecode.Output
+
 // CoinMetas represents a slice of CoinMeta
 type CoinMetas []CoinMeta
+
+// WatchOnlyWallet represents a wallet that only holds addresses, no private keys.
+// For bitcoin, addresses can be derived from an extended public key
+type WatchOnlyWallet struct {
+	ID          string   `json:"id"`
+	CoinType    string   `json:"coinType"`
+	Xpub        string   `json:"xpub,omitempty"`
+	Addrs       []string `json:"addrs"`
+	ChangeAddrs []string `json:"changeAddrs,omitempty"`
+}
+
+// PaymentRequest represents a payment request encoded in a skycoin: or bitcoin: URI
+type PaymentRequest struct {
+	CoinType string `json:"coinType"`
+	Address  string `json:"address"`
+	Amount   string `json:"amount,omitempty"`
+	Hours    string `json:"hours,omitempty"`
+	Label    string `json:"label,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
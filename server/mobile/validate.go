@@ -0,0 +1,79 @@
+package mobile
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hankgao/superwallet-server/server/mobile/bitcoin"
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+const (
+	// skycoin based coins accept at most 3 decimals, i.e, 1000 droplets
+	skycoinMaxDecimals = 3
+	bitcoinMaxDecimals = 8
+	bitcoinMaxSupply   = 21000000
+)
+
+// ValidateAddress checks that address is a valid address of coinType,
+// including the checksum and, for bitcoin, the network
+func ValidateAddress(coinType, address string) error {
+	if address == "" {
+		return errors.New("address is empty")
+	}
+
+	if coinType == "bitcoin" {
+		return bitcoin.ValidateAddress(address)
+	}
+
+	if _, err := cipher.DecodeBase58Address(address); err != nil {
+		return fmt.Errorf("invalid %s address %s: %v", coinType, address, err)
+	}
+
+	return nil
+}
+
+// ValidateAmount checks that amount, a decimal string such as "1.001", can be sent with coinType
+func ValidateAmount(coinType, amount string) error {
+	amount = strings.TrimSpace(amount)
+
+	// only plain decimal notation, ParseFloat would also accept exponents, Inf and NaN
+	if amount == "" || strings.Trim(amount, "0123456789.") != "" || strings.Count(amount, ".") > 1 {
+		return fmt.Errorf("invalid amount %s", amount)
+	}
+
+	v, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s", amount)
+	}
+
+	if v <= 0 {
+		return fmt.Errorf("amount must be greater than 0")
+	}
+
+	maxDecimals := skycoinMaxDecimals
+	if coinType == "bitcoin" {
+		maxDecimals = bitcoinMaxDecimals
+		if v > bitcoinMaxSupply {
+			return fmt.Errorf("amount %s exceeds bitcoin max supply", amount)
+		}
+	}
+
+	if n := decimals(amount); n > maxDecimals {
+		return fmt.Errorf("%s supports at most %d decimals, %s has %d", coinType, maxDecimals, amount, n)
+	}
+
+	return nil
+}
+
+// decimals returns the number of significant digits after the decimal point
+func decimals(amount string) int {
+	i := strings.IndexByte(amount, '.')
+	if i < 0 {
+		return 0
+	}
+
+	return len(strings.TrimRight(amount[i+1:], "0"))
+}
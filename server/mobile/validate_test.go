@@ -0,0 +1,78 @@
+package mobile
+
+import (
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+func TestValidateAddress(t *testing.T) {
+	pub, _ := cipher.GenerateKeyPair()
+	skyAddr := cipher.AddressFromPubKey(pub).String()
+	btcAddr := cipher.BitcoinAddressFromPubkey(pub)
+
+	// flip the last character so that the checksum no longer matches
+	last := "z"
+	if skyAddr[len(skyAddr)-1] == 'z' {
+		last = "y"
+	}
+	badSkyAddr := skyAddr[:len(skyAddr)-1] + last
+
+	cases := []struct {
+		coinType string
+		address  string
+		valid    bool
+	}{
+		{"skycoin", skyAddr, true},
+		{"mzcoin", skyAddr, true},
+		{"skycoin", badSkyAddr, false},
+		{"skycoin", "", false},
+		{"skycoin", btcAddr, false},
+		{"bitcoin", btcAddr, true},
+		{"bitcoin", "19EC57DDAtTCVcKENVcd5tbRXk7yKSKvGK", true},
+		{"bitcoin", "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", false}, // testnet
+		{"bitcoin", "19EC57DDAtTCVcKENVcd5tbRXk7yKSKvGL", false},
+	}
+
+	for _, c := range cases {
+		err := ValidateAddress(c.coinType, c.address)
+		if c.valid && err != nil {
+			t.Errorf("%s address %q should be valid: %v", c.coinType, c.address, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s address %q should be invalid", c.coinType, c.address)
+		}
+	}
+}
+
+func TestValidateAmount(t *testing.T) {
+	cases := []struct {
+		coinType string
+		amount   string
+		valid    bool
+	}{
+		{"skycoin", "1", true},
+		{"skycoin", "1.001", true},
+		{"skycoin", "1.0010", true},
+		{"skycoin", "1.0001", false},
+		{"skycoin", "0", false},
+		{"skycoin", "-1", false},
+		{"skycoin", "1e3", false},
+		{"skycoin", "NaN", false},
+		{"skycoin", "1.2.3", false},
+		{"skycoin", "", false},
+		{"bitcoin", "0.00000001", true},
+		{"bitcoin", "0.000000001", false},
+		{"bitcoin", "21000001", false},
+	}
+
+	for _, c := range cases {
+		err := ValidateAmount(c.coinType, c.amount)
+		if c.valid && err != nil {
+			t.Errorf("%s amount %q should be valid: %v", c.coinType, c.amount, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s amount %q should be invalid", c.coinType, c.amount)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package mobile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hankgao/superwallet-server/server/mobile/bitcoin"
+)
+
+// ErrWatchOnly is returned when trying to send coins from a watch-only wallet or address
+var ErrWatchOnly = errors.New("watch-only wallet cannot send coins")
+
+var (
+	watchOnlyMutex   sync.RWMutex
+	watchOnlyWallets = make(map[string]WatchOnlyWallet)
+)
+
+// ImportWatchOnlyAddresses creates a watch-only wallet from a comma separated list of addresses,
+// the wallet is returned in JSON format so that the app can persist it and import it again later
+func ImportWatchOnlyAddresses(walletID, coinType, addresses string) (string, error) {
+	if walletID == "" {
+		return "", errors.New("wallet id is empty")
+	}
+
+	addrs := splitAddresses(addresses)
+	if len(addrs) == 0 {
+		return "", errors.New("no address to import")
+	}
+
+	for _, addr := range addrs {
+		if err := ValidateAddress(coinType, addr); err != nil {
+			return "", err
+		}
+	}
+
+	return saveWatchOnlyWallet(WatchOnlyWallet{
+		ID:       walletID,
+		CoinType: coinType,
+		Addrs:    addrs,
+	})
+}
+
+// ImportWatchOnlyXpub creates a bitcoin watch-only wallet from an account extended public key,
+// receiveQty receive addresses and changeQty change addresses are derived from it
+func ImportWatchOnlyXpub(walletID, xpub string, receiveQty, changeQty int) (string, error) {
+	if walletID == "" {
+		return "", errors.New("wallet id is empty")
+	}
+
+	addrs, err := bitcoin.DeriveAddressesFromXpub(xpub, bitcoin.ReceiveChain, 0, receiveQty)
+	if err != nil {
+		return "", err
+	}
+
+	changeAddrs, err := bitcoin.DeriveAddressesFromXpub(xpub, bitcoin.ChangeChain, 0, changeQty)
+	if err != nil {
+		return "", err
+	}
+
+	return saveWatchOnlyWallet(WatchOnlyWallet{
+		ID:          walletID,
+		CoinType:    "bitcoin",
+		Xpub:        xpub,
+		Addrs:       addrs,
+		ChangeAddrs: changeAddrs,
+	})
+}
+
+// GetWatchOnlyWallet returns a watch-only wallet in JSON format
+func GetWatchOnlyWallet(walletID string) (string, error) {
+	w, err := getWatchOnlyWallet(walletID)
+	if err != nil {
+		return "", err
+	}
+
+	jsonBytes, err := json.MarshalIndent(w, "", "    ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonBytes), nil
+}
+
+// RemoveWatchOnlyWallet forgets a watch-only wallet
+func RemoveWatchOnlyWallet(walletID string) {
+	watchOnlyMutex.Lock()
+	defer watchOnlyMutex.Unlock()
+
+	delete(watchOnlyWallets, walletID)
+}
+
+// WatchOnlyGetBalance returns the balance of all addresses of a watch-only wallet
+func WatchOnlyGetBalance(walletID string) (string, error) {
+	w, err := getWatchOnlyWallet(walletID)
+	if err != nil {
+		return "", err
+	}
+
+	return GetBalance(w.CoinType, strings.Join(w.allAddrs(), ","))
+}
+
+// WatchOnlyGetOutputs returns unspent outputs of all addresses of a watch-only wallet
+func WatchOnlyGetOutputs(walletID string) (string, error) {
+	w, err := getWatchOnlyWallet(walletID)
+	if err != nil {
+		return "", err
+	}
+
+	return GetOutputs(w.CoinType, strings.Join(w.allAddrs(), ","))
+}
+
+// WatchOnlyGetHistory returns the transaction history of all addresses of a watch-only wallet
+func WatchOnlyGetHistory(walletID string) (string, error) {
+	w, err := getWatchOnlyWallet(walletID)
+	if err != nil {
+		return "", err
+	}
+
+	return GetAddressTransactions(w.CoinType, strings.Join(w.allAddrs(), ","))
+}
+
+// WatchOnlySendCoin always fails, it exists so that the app can treat all wallets the same way
+func WatchOnlySendCoin(walletID, targetAddress string, amount float64) (string, error) {
+	if _, err := getWatchOnlyWallet(walletID); err != nil {
+		return "", err
+	}
+
+	return "", ErrWatchOnly
+}
+
+func (w WatchOnlyWallet) allAddrs() []string {
+	addrs := make([]string, 0, len(w.Addrs)+len(w.ChangeAddrs))
+	addrs = append(addrs, w.Addrs...)
+	return append(addrs, w.ChangeAddrs...)
+}
+
+func saveWatchOnlyWallet(w WatchOnlyWallet) (string, error) {
+	jsonBytes, err := json.MarshalIndent(w, "", "    ")
+	if err != nil {
+		return "", err
+	}
+
+	watchOnlyMutex.Lock()
+	watchOnlyWallets[w.ID] = w
+	watchOnlyMutex.Unlock()
+
+	return string(jsonBytes), nil
+}
+
+func getWatchOnlyWallet(walletID string) (WatchOnlyWallet, error) {
+	watchOnlyMutex.RLock()
+	defer watchOnlyMutex.RUnlock()
+
+	w, ok := watchOnlyWallets[walletID]
+	if !ok {
+		return WatchOnlyWallet{}, fmt.Errorf("watch-only wallet %s not found", walletID)
+	}
+
+	return w, nil
+}
+
+// isWatchOnlyAddress checks whether addr belongs to any watch-only wallet of coinType
+func isWatchOnlyAddress(coinType, addr string) bool {
+	watchOnlyMutex.RLock()
+	defer watchOnlyMutex.RUnlock()
+
+	for _, w := range watchOnlyWallets {
+		if w.CoinType != coinType {
+			continue
+		}
+		for _, a := range w.allAddrs() {
+			if a == addr {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func splitAddresses(addresses string) []string {
+	var addrs []string
+	for _, a := range strings.Split(addresses, ",") {
+		a = strings.TrimSpace(a)
+		if a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
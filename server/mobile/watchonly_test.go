@@ -0,0 +1,90 @@
+package mobile
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportWatchOnlyAddresses(t *testing.T) {
+	pub, _ := cipher.GenerateKeyPair()
+	addr := cipher.AddressFromPubKey(pub).String()
+	defer RemoveWatchOnlyWallet("sky-watch")
+
+	s, err := ImportWatchOnlyAddresses("sky-watch", "skycoin", " "+addr+", ,")
+	assert.Nil(t, err)
+
+	var w WatchOnlyWallet
+	assert.Nil(t, json.Unmarshal([]byte(s), &w))
+	assert.Equal(t, WatchOnlyWallet{ID: "sky-watch", CoinType: "skycoin", Addrs: []string{addr}}, w)
+
+	s, err = GetWatchOnlyWallet("sky-watch")
+	assert.Nil(t, err)
+	assert.Contains(t, s, addr)
+
+	assert.True(t, isWatchOnlyAddress("skycoin", addr))
+	assert.False(t, isWatchOnlyAddress("mzcoin", addr))
+
+	_, err = ImportWatchOnlyAddresses("sky-invalid", "skycoin", addr+",invalid")
+	assert.NotNil(t, err)
+	_, err = GetWatchOnlyWallet("sky-invalid")
+	assert.NotNil(t, err)
+
+	_, err = ImportWatchOnlyAddresses("sky-empty", "skycoin", " , ")
+	assert.NotNil(t, err)
+
+	_, err = ImportWatchOnlyAddresses("", "skycoin", addr)
+	assert.NotNil(t, err)
+
+	RemoveWatchOnlyWallet("sky-watch")
+	_, err = GetWatchOnlyWallet("sky-watch")
+	assert.NotNil(t, err)
+	assert.False(t, isWatchOnlyAddress("skycoin", addr))
+}
+
+func TestImportWatchOnlyXpub(t *testing.T) {
+	// account key m/44'/0'/0' of the BIP39 mnemonic "abandon abandon ... about"
+	xpub := "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"
+	defer RemoveWatchOnlyWallet("btc-watch")
+
+	s, err := ImportWatchOnlyXpub("btc-watch", xpub, 2, 1)
+	assert.Nil(t, err)
+
+	var w WatchOnlyWallet
+	assert.Nil(t, json.Unmarshal([]byte(s), &w))
+	assert.Equal(t, "bitcoin", w.CoinType)
+	assert.Equal(t, xpub, w.Xpub)
+	assert.Equal(t, []string{"1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", "1Ak8PffB2meyfYnbXZR9EGfLfFZVpzJvQP"}, w.Addrs)
+	assert.Equal(t, []string{"1J3J6EvPrv8q6AC3VCjWV45Uf3nssNMRtH"}, w.ChangeAddrs)
+	assert.True(t, isWatchOnlyAddress("bitcoin", "1J3J6EvPrv8q6AC3VCjWV45Uf3nssNMRtH"))
+
+	// private keys are never held by watch-only wallets
+	xprv := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+	_, err = ImportWatchOnlyXpub("btc-xprv", xprv, 1, 1)
+	assert.NotNil(t, err)
+	_, err = GetWatchOnlyWallet("btc-xprv")
+	assert.NotNil(t, err)
+}
+
+func TestWatchOnlySendCoin(t *testing.T) {
+	pub, _ := cipher.GenerateKeyPair()
+	addr := cipher.AddressFromPubKey(pub).String()
+	target := cipher.AddressFromPubKey(pub).String()
+	defer RemoveWatchOnlyWallet("sky-send")
+
+	_, err := ImportWatchOnlyAddresses("sky-send", "skycoin", addr)
+	assert.Nil(t, err)
+
+	_, err = WatchOnlySendCoin("sky-send", target, 1)
+	assert.Equal(t, ErrWatchOnly, err)
+
+	// the app may also send from the addresses of a watch-only wallet without its ID
+	_, err = SendCoin("skycoin", addr, "", target, 1)
+	assert.Equal(t, ErrWatchOnly, err)
+
+	_, err = WatchOnlySendCoin("unknown", target, 1)
+	assert.NotNil(t, err)
+	assert.NotEqual(t, ErrWatchOnly, err)
+}
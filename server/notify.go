@@ -0,0 +1,432 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+const (
+	// notifyQueueSize bounds the notifications waiting to be sent, more are dropped
+	notifyQueueSize = 1000
+
+	// minSubscriptionSecretLen is the length at least of the secret apps protect their subscription with
+	minSubscriptionSecretLen = 16
+)
+
+var (
+	// errSubscriptionsFull is returned when a new device would exceed the subscriptions limit
+	errSubscriptionsFull = errors.New("too many subscriptions, please try again later")
+
+	// errTooManySubscribedAddrs is returned when a device would exceed the addresses limit, all coins together
+	errTooManySubscribedAddrs = errors.New("too many subscribed addresses")
+
+	// errWrongSubscriptionSecret is returned when a device subscription is changed without the secret it was created with
+	errWrongSubscriptionSecret = errors.New("wrong subscription secret")
+)
+
+// subscription is a device registered for payments to its addresses. Tokens reach other apps, i.e,
+// through notification services, so changing a subscription also takes the secret it was created with
+type subscription struct {
+	Token      string              `json:"token"`
+	Platform   string              `json:"platform"`
+	SecretHash string              `json:"secretHash,omitempty"` // hex sha256 of the secret
+	Addrs      map[string][]string `json:"addrs"`                // keyed by coin
+}
+
+// checkSecret tells if secret is the one the subscription was created with, subscriptions saved
+// before secrets were required are claimed by the first secret given
+func (s *subscription) checkSecret(secret string) bool {
+	if s.SecretHash == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(hashSubscriptionSecret(secret)), []byte(s.SecretHash)) == 1
+}
+
+func hashSubscriptionSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// subscriptionStore holds subscriptions indexed by coin and address, and saves them to file if set.
+// At most maxSubs devices are subscribed, each one to at most maxAddrs addresses of all coins
+type subscriptionStore struct {
+	file     string
+	maxSubs  int
+	maxAddrs int
+
+	sync.RWMutex
+	subs  map[string]*subscription
+	index map[string]map[string][]string // coin, address, tokens
+}
+
+func newSubscriptionStore(file string, maxSubs, maxAddrs int) (*subscriptionStore, error) {
+	ss := &subscriptionStore{
+		file:     file,
+		maxSubs:  maxSubs,
+		maxAddrs: maxAddrs,
+		subs:     make(map[string]*subscription),
+	}
+
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, fmt.Errorf("failed to read subscriptions file: %v", err)
+		default:
+			var subs []*subscription
+			if err := json.Unmarshal(b, &subs); err != nil {
+				return nil, fmt.Errorf("failed to parse subscriptions file %s: %v", file, err)
+			}
+			for _, s := range subs {
+				ss.subs[s.Token] = s
+			}
+		}
+	}
+
+	ss.reindex()
+
+	return ss, nil
+}
+
+// reindex rebuilds the address index, the caller holds the lock
+func (ss *subscriptionStore) reindex() {
+	ss.index = make(map[string]map[string][]string)
+	for token, s := range ss.subs {
+		for coinType, addrs := range s.Addrs {
+			if ss.index[coinType] == nil {
+				ss.index[coinType] = make(map[string][]string)
+			}
+			for _, a := range addrs {
+				ss.index[coinType][a] = append(ss.index[coinType][a], token)
+			}
+		}
+	}
+}
+
+// save writes the subscriptions to file, the caller holds the lock
+func (ss *subscriptionStore) save() error {
+	if ss.file == "" {
+		return nil
+	}
+
+	subs := make([]*subscription, 0, len(ss.subs))
+	for _, s := range ss.subs {
+		subs = append(subs, s)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Token < subs[j].Token
+	})
+
+	b, err := json.MarshalIndent(subs, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(ss.file, b, 0600)
+}
+
+// set replaces the addresses of a device for a coin, no addresses unsubscribes the device from the coin.
+// Apps register on every start, the file is only rewritten when the subscription changes
+func (ss *subscriptionStore) set(token, secret, platform, coinType string, addrs []string) error {
+	ss.Lock()
+	defer ss.Unlock()
+
+	s, ok := ss.subs[token]
+	if ok && !s.checkSecret(secret) {
+		return errWrongSubscriptionSecret
+	}
+	if !ok {
+		if len(addrs) == 0 {
+			return nil
+		}
+		if len(ss.subs) >= ss.maxSubs {
+			return errSubscriptionsFull
+		}
+		s = &subscription{Token: token, Addrs: make(map[string][]string)}
+	}
+
+	secretHash := hashSubscriptionSecret(secret)
+	if ok && s.Platform == platform && s.SecretHash == secretHash && equalStrings(s.Addrs[coinType], addrs) {
+		return nil
+	}
+
+	n := len(addrs)
+	for c, a := range s.Addrs {
+		if c != coinType {
+			n += len(a)
+		}
+	}
+	if n > ss.maxAddrs {
+		return fmt.Errorf("%w: %d, at most %d are allowed for a device", errTooManySubscribedAddrs, n, ss.maxAddrs)
+	}
+
+	ss.subs[token] = s
+	s.Platform = platform
+	s.SecretHash = secretHash
+
+	if len(addrs) == 0 {
+		delete(s.Addrs, coinType)
+	} else {
+		s.Addrs[coinType] = addrs
+	}
+
+	if len(s.Addrs) == 0 {
+		delete(ss.subs, token)
+	}
+
+	ss.reindex()
+	return ss.save()
+}
+
+// remove unsubscribes a device from all coins, i.e, when its token is no longer valid
+func (ss *subscriptionStore) remove(token string) error {
+	ss.Lock()
+	defer ss.Unlock()
+
+	if _, ok := ss.subs[token]; !ok {
+		return nil
+	}
+
+	delete(ss.subs, token)
+	ss.reindex()
+	return ss.save()
+}
+
+// unsubscribe removes a device on request of its app, which proves it owns the subscription with its secret
+func (ss *subscriptionStore) unsubscribe(token, secret string) error {
+	ss.Lock()
+	defer ss.Unlock()
+
+	s, ok := ss.subs[token]
+	if !ok {
+		return nil
+	}
+	if !s.checkSecret(secret) {
+		return errWrongSubscriptionSecret
+	}
+
+	delete(ss.subs, token)
+	ss.reindex()
+	return ss.save()
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// subscribers returns the devices subscribed to an address
+func (ss *subscriptionStore) subscribers(coinType, addr string) []subscription {
+	ss.RLock()
+	defer ss.RUnlock()
+
+	var ret []subscription
+	for _, token := range ss.index[coinType][addr] {
+		ret = append(ret, *ss.subs[token])
+	}
+	return ret
+}
+
+// notifier turns payments to subscribed addresses into notifications and sends them
+// in the background with the sender of the platform of each device
+type notifier struct {
+	store   *subscriptionStore
+	senders map[string]notificationSender
+	queue   chan notification
+}
+
+func newNotifier(store *subscriptionStore, senders map[string]notificationSender) *notifier {
+	return &notifier{
+		store:   store,
+		senders: senders,
+		queue:   make(chan notification, notifyQueueSize),
+	}
+}
+
+// handlePayment is a payment handler of the payment scanner
+func (n *notifier) handlePayment(p payment) {
+	for _, s := range n.store.subscribers(p.CoinType, p.Address) {
+		symbol := p.CoinType
+		if cm, ok := coins.get(p.CoinType); ok {
+			symbol = cm.Symbol
+		}
+
+		nt := notification{
+			Token:    s.Token,
+			Platform: s.Platform,
+			Title:    "Payment received",
+			Body:     fmt.Sprintf("%s %s received on %s", p.Coins, symbol, p.Address),
+			Payment:  p,
+		}
+
+		select {
+		case n.queue <- nt:
+		default:
+			log.Warnf("[%s] notification queue is full, dropping notification of %s", p.CoinType, p.Txid)
+		}
+	}
+}
+
+// run sends queued notifications until quit is closed
+func (n *notifier) run(quit chan struct{}) {
+	for {
+		select {
+		case <-quit:
+			return
+		case nt := <-n.queue:
+			n.send(nt)
+		}
+	}
+}
+
+func (n *notifier) send(nt notification) {
+	sender, ok := n.senders[nt.Platform]
+	if !ok {
+		log.Errorf("no sender for platform %s", nt.Platform)
+		return
+	}
+
+	err := sender.send(nt)
+	switch {
+	case err == errInvalidToken:
+		// the app was uninstalled or the token was refreshed
+		log.Infof("dropping invalid %s token", nt.Platform)
+		if err := n.store.remove(nt.Token); err != nil {
+			log.Errorf("failed to remove subscription: %s", err)
+		}
+	case err != nil:
+		log.Errorf("[%s] failed to send %s notification of %s: %s", nt.Payment.CoinType, nt.Platform, nt.Payment.Txid, err)
+	}
+}
+
+// subscriptionsHandler registers a device for payments to addresses of a coin with POST,
+// the body being {"token": "...", "secret": "...", "platform": "apns", "coinType": "skycoin", "addrs": ["..."]},
+// an empty addrs list unsubscribes the device from the coin. The secret is chosen by the app on
+// its first registration, later changes of the subscription must give the same one.
+// DELETE /subscriptions?token=...&secret=... unsubscribes a device from all coins
+func subscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "DELETE" {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			http.Error(w, "missing token", http.StatusBadRequest)
+			return
+		}
+
+		err := notifications.store.unsubscribe(token, r.URL.Query().Get("secret"))
+		if err == errWrongSubscriptionSecret {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			requestLogger(r).Errorf("failed to remove subscription: %s", err)
+			http.Error(w, fmt.Sprintf("failed to remove subscription: %s", err), http.StatusInternalServerError)
+			return
+		}
+		return
+	}
+
+	req := struct {
+		Token    string   `json:"token"`
+		Secret   string   `json:"secret"`
+		Platform string   `json:"platform"`
+		CoinType string   `json:"coinType"`
+		Addrs    []string `json:"addrs"`
+	}{}
+
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %s", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if err := json.Unmarshal(b, &req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid subscription: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateSubscription(req.Token, req.Secret, req.Platform, req.CoinType, req.Addrs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the coin is in the body, keys.middleware only checks the coinType of the path
+	if k, ok := requestAPIKey(r.Context()); ok && !k.allowsCoin(req.CoinType) {
+		http.Error(w, fmt.Sprintf("API key %s is not allowed to access %s", k.Name, req.CoinType), http.StatusForbidden)
+		return
+	}
+
+	err = notifications.store.set(req.Token, req.Secret, req.Platform, req.CoinType, req.Addrs)
+	switch {
+	case err == errWrongSubscriptionSecret:
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, errTooManySubscribedAddrs):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err == errSubscriptionsFull:
+		requestLogger(r).Warn("subscriptions limit reached")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		requestLogger(r).Errorf("failed to save subscription: %s", err)
+		http.Error(w, fmt.Sprintf("failed to save subscription: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+func validateSubscription(token, secret, platform, coinType string, addrs []string) error {
+	if token == "" {
+		return errors.New("missing token")
+	}
+
+	// APNs device tokens go into the request path
+	if platform == "apns" {
+		if _, err := hex.DecodeString(token); err != nil {
+			return errors.New("invalid token, APNs device tokens are hex encoded")
+		}
+	}
+
+	if len(secret) < minSubscriptionSecretLen {
+		return fmt.Errorf("secret must be at least %d characters", minSubscriptionSecretLen)
+	}
+
+	if _, ok := notifications.senders[platform]; !ok {
+		return fmt.Errorf("platform %q is not supported", platform)
+	}
+
+	if !isCoinTypeSupported(coinType) {
+		return fmt.Errorf("%s is not supported", coinType)
+	}
+
+	if cfg.MaxAddrs > 0 && len(addrs) > cfg.MaxAddrs {
+		return fmt.Errorf("too many addresses: %d, at most %d are allowed", len(addrs), cfg.MaxAddrs)
+	}
+
+	for _, a := range addrs {
+		if _, err := cipher.DecodeBase58Address(a); err != nil {
+			return fmt.Errorf("invalid address %s: %v", a, err)
+		}
+	}
+
+	return nil
+}
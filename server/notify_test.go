@@ -0,0 +1,324 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+)
+
+type fakeSender struct {
+	sent []notification
+	err  error
+}
+
+func (s *fakeSender) send(n notification) error {
+	s.sent = append(s.sent, n)
+	return s.err
+}
+
+func TestSubscriptionStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "superwallet-subscriptions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "subscriptions.json")
+	ss, err := newSubscriptionStore(file, 10, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ss.set("t1", "s3cret-of-t1-0000", "log", "skycoin", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.set("t2", "s3cret-of-t2-0000", "log", "skycoin", []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.set("t1", "s3cret-of-t1-0000", "log", "mzcoin", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if subs := ss.subscribers("skycoin", "b"); len(subs) != 2 {
+		t.Fatalf("expected 2 subscribers of b, got %d", len(subs))
+	}
+
+	// subscriptions survive a restart
+	reloaded, err := newSubscriptionStore(file, 10, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subs := reloaded.subscribers("mzcoin", "a"); len(subs) != 1 || subs[0].Token != "t1" {
+		t.Fatalf("unexpected subscribers %+v", subs)
+	}
+
+	if err := ss.set("t1", "s3cret-of-t1-0000", "log", "skycoin", nil); err != nil {
+		t.Fatal(err)
+	}
+	if subs := ss.subscribers("skycoin", "a"); len(subs) != 0 {
+		t.Fatalf("t1 should be unsubscribed from skycoin, got %+v", subs)
+	}
+
+	if err := ss.remove("t1"); err != nil {
+		t.Fatal(err)
+	}
+	if subs := ss.subscribers("mzcoin", "a"); len(subs) != 0 {
+		t.Fatalf("t1 should be removed, got %+v", subs)
+	}
+}
+
+func TestSubscriptionStoreLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "superwallet-subscriptions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "subscriptions.json")
+	ss, err := newSubscriptionStore(file, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ss.set("t1", "s3cret-of-t1-0000", "apns", "skycoin", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.set("t1", "s3cret-of-t1-0000", "apns", "mzcoin", []string{"c", "d"}); !errors.Is(err, errTooManySubscribedAddrs) {
+		t.Fatalf("addresses of all coins should count, got %v", err)
+	}
+	// replacing the addresses of a coin doesn't add to them
+	if err := ss.set("t1", "s3cret-of-t1-0000", "apns", "skycoin", []string{"a", "b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ss.set("t2", "s3cret-of-t2-0000", "apns", "skycoin", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.set("t3", "s3cret-of-t3-0000", "apns", "skycoin", []string{"a"}); err != errSubscriptionsFull {
+		t.Fatalf("a third device should be refused, got %v", err)
+	}
+	if err := ss.set("t3", "s3cret-of-t3-0000", "apns", "skycoin", nil); err != nil {
+		t.Fatalf("unsubscribing unknown devices is a no-op, got %v", err)
+	}
+
+	// registering the same subscription again doesn't rewrite the file
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.set("t2", "s3cret-of-t2-0000", "apns", "skycoin", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatal("unchanged subscriptions should not be saved")
+	}
+}
+
+func TestSubscriptionSecret(t *testing.T) {
+	ss, err := newSubscriptionStore("", 10, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.set("t1", "s3cret-of-t1-0000", "apns", "skycoin", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ss.set("t1", "someone-else-0000", "apns", "skycoin", []string{"b"}); err != errWrongSubscriptionSecret {
+		t.Fatalf("changing a subscription should take its secret, got %v", err)
+	}
+	if err := ss.unsubscribe("t1", "someone-else-0000"); err != errWrongSubscriptionSecret {
+		t.Fatalf("removing a subscription should take its secret, got %v", err)
+	}
+	if subs := ss.subscribers("skycoin", "a"); len(subs) != 1 {
+		t.Fatalf("subscription should be unchanged, got %+v", subs)
+	}
+
+	if err := ss.unsubscribe("t1", "s3cret-of-t1-0000"); err != nil {
+		t.Fatal(err)
+	}
+	if subs := ss.subscribers("skycoin", "a"); len(subs) != 0 {
+		t.Fatalf("t1 should be removed, got %+v", subs)
+	}
+
+	// subscriptions saved without a secret are claimed by the first one given
+	ss.subs["t2"] = &subscription{Token: "t2", Platform: "apns", Addrs: map[string][]string{"skycoin": {"a"}}}
+	if err := ss.set("t2", "s3cret-of-t2-0000", "apns", "skycoin", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.unsubscribe("t2", "someone-else-0000"); err != errWrongSubscriptionSecret {
+		t.Fatalf("claimed subscription should take its secret, got %v", err)
+	}
+}
+
+func TestValidateSubscription(t *testing.T) {
+	defer func(c *coinRegistry, sc serverConfig, n *notifier) { coins, cfg, notifications = c, sc, n }(coins, cfg, notifications)
+	coins = &coinRegistry{list: skywallet.CoinMetas{{NameInEnglish: "skycoin", Symbol: "SKY"}}}
+	cfg = defaultConfig()
+	notifications = newNotifier(nil, map[string]notificationSender{"apns": &fakeSender{}, "fcm": &fakeSender{}})
+
+	addr := "2GgFvqoyk9RjwVzj8tqfcXVXB4orBwoc9qv"
+	for _, tc := range []struct {
+		token, secret, platform string
+		valid                   bool
+	}{
+		{"a1b2c3", "s3cret-of-t1-0000", "apns", true},
+		{"../../3/device/a1b2c3", "s3cret-of-t1-0000", "apns", false},
+		{"fcm:token-1", "s3cret-of-t1-0000", "fcm", true},
+		{"a1b2c3", "short", "apns", false},
+		{"a1b2c3", "s3cret-of-t1-0000", "sms", false},
+	} {
+		err := validateSubscription(tc.token, tc.secret, tc.platform, "skycoin", []string{addr})
+		if (err == nil) != tc.valid {
+			t.Errorf("subscription of %s on %s with secret %q: unexpected error %v", tc.token, tc.platform, tc.secret, err)
+		}
+	}
+}
+
+func TestAPNsSenderRejectsInvalidTokens(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s", r.URL.Path)
+	}))
+	defer srv.Close()
+
+	s := &apnsSender{host: srv.URL, client: http.DefaultClient}
+	if err := s.send(notification{Token: "../../x"}); err != errInvalidToken {
+		t.Fatalf("non hex tokens should be invalid, got %v", err)
+	}
+}
+
+func TestNotifierDropsInvalidTokens(t *testing.T) {
+	ss, err := newSubscriptionStore("", 10, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.set("t1", "s3cret-of-t1-0000", "fake", "skycoin", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sender := &fakeSender{err: errInvalidToken}
+	n := newNotifier(ss, map[string]notificationSender{"fake": sender})
+
+	n.handlePayment(payment{CoinType: "skycoin", Address: "a", Txid: "tx", Coins: "1.000000"})
+	n.handlePayment(payment{CoinType: "skycoin", Address: "c", Txid: "tx", Coins: "1.000000"})
+	if len(n.queue) != 1 {
+		t.Fatalf("expected 1 queued notification, got %d", len(n.queue))
+	}
+
+	n.send(<-n.queue)
+	if len(sender.sent) != 1 || sender.sent[0].Token != "t1" {
+		t.Fatalf("unexpected notifications %+v", sender.sent)
+	}
+	if subs := ss.subscribers("skycoin", "a"); len(subs) != 0 {
+		t.Fatal("invalid token should be unsubscribed")
+	}
+}
+
+func TestAPNsProviderToken(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &apnsSender{keyID: "KEY", teamID: "TEAM", key: key}
+	token, err := s.providerToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("invalid JWT %s", token)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		t.Fatalf("invalid signature %s", parts[2])
+	}
+
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, ss := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(&key.PublicKey, hash[:], r, ss) {
+		t.Fatal("signature doesn't verify")
+	}
+
+	if again, _ := s.providerToken(); again != token {
+		t.Fatal("token should be reused until it expires")
+	}
+}
+
+func TestFCMSender(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokenRequests int
+	oauth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if len(parts) != 3 {
+			t.Errorf("invalid JWT %s", r.FormValue("assertion"))
+			return
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], sig); err != nil {
+			t.Errorf("signature doesn't verify: %v", err)
+		}
+		w.Write([]byte(`{"access_token": "access", "expires_in": 3600, "token_type": "Bearer"}`))
+	}))
+	defer oauth.Close()
+
+	var messages []map[string]map[string]interface{}
+	fcm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/wallet/messages:send" || r.Header.Get("Authorization") != "Bearer access" {
+			t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var m map[string]map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&m)
+		messages = append(messages, m)
+
+		if m["message"]["token"] == "gone" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": 404, "status": "NOT_FOUND", "details": [{"errorCode": "UNREGISTERED"}]}}`))
+		}
+	}))
+	defer fcm.Close()
+
+	s := &fcmSender{
+		host:   fcm.URL,
+		creds:  &fcmCredentials{ProjectID: "wallet", ClientEmail: "push@wallet.iam.gserviceaccount.com", TokenURI: oauth.URL},
+		key:    key,
+		client: http.DefaultClient,
+	}
+
+	p := payment{CoinType: "skycoin", Address: "a", Txid: "tx", Coins: "1.000000", Hours: 3}
+	if err := s.send(notification{Token: "t1", Title: "Payment received", Payment: p}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.send(notification{Token: "gone", Payment: p}); err != errInvalidToken {
+		t.Fatalf("unregistered tokens should be invalid, got %v", err)
+	}
+
+	if tokenRequests != 1 {
+		t.Fatalf("access token should be reused until it expires, got %d requests", tokenRequests)
+	}
+	if data, _ := messages[0]["message"]["data"].(map[string]interface{}); data["hours"] != "3" {
+		t.Fatalf("data values should be strings, got %+v", messages[0])
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/skycoin/skycoin/src/api"
+	"github.com/skycoin/skycoin/src/visor"
+)
+
+// payment is an output of a confirmed transaction to someone else than its sender
+type payment struct {
+	CoinType string `json:"coinType"`
+	Address  string `json:"address"`
+	Txid     string `json:"txid"`
+	Coins    string `json:"coins"`
+	Hours    uint64 `json:"hours"`
+	BlockSeq uint64 `json:"blockSeq"`
+}
+
+// paymentScanner reads the blocks reported by the block watcher and passes each output they
+// contain to its handlers, which pick the addresses they are interested in. Change going back
+// to an address of the sender is not a payment
+type paymentScanner struct {
+	maxBlocks   uint64                               // blocks scanned at most per new block, i.e, after a long node outage
+	firstHeight func(coinType string) (uint64, bool) // height the watcher first saw, scanning starts after it
+
+	sync.Mutex
+	scanned  map[string]uint64 // last scanned block per coin
+	handlers []func(p payment)
+}
+
+func newPaymentScanner(maxBlocks uint64, firstHeight func(coinType string) (uint64, bool)) *paymentScanner {
+	return &paymentScanner{
+		maxBlocks:   maxBlocks,
+		firstHeight: firstHeight,
+		scanned:     make(map[string]uint64),
+	}
+}
+
+// onPayment registers a handler, handlers must be registered before the watcher runs
+func (ps *paymentScanner) onPayment(f func(p payment)) {
+	ps.Lock()
+	defer ps.Unlock()
+
+	ps.handlers = append(ps.handlers, f)
+}
+
+// scan reads the blocks after the last scanned one up to height, it is a new block handler of the watcher
+func (ps *paymentScanner) scan(coinType string, height uint64) {
+	ps.Lock()
+	last, ok := ps.scanned[coinType]
+	handlers := ps.handlers
+	ps.Unlock()
+
+	if len(handlers) == 0 || height == 0 {
+		return
+	}
+
+	// the first scan starts after the block seen when the node was first reached, so blocks found
+	// between then and the first new block event are not skipped
+	if !ok {
+		last = height - 1
+		if first, seen := ps.firstHeight(coinType); seen && first < height {
+			last = first
+		}
+	}
+	if last >= height {
+		last = height - 1
+	}
+	if height-last > ps.maxBlocks {
+		log.Warnf("[%s] %d blocks to scan, only the last %d are scanned", coinType, height-last, ps.maxBlocks)
+		last = height - ps.maxBlocks
+	}
+
+	c := newNodeClient(coinType)
+	for seq := last + 1; seq <= height; seq++ {
+		var b *visor.ReadableBlock
+		err := observeNodeCall(context.Background(), coinType, "block", func() error {
+			var err error
+			b, err = c.BlockBySeq(seq)
+			return err
+		})
+		if err != nil {
+			// retried on the next block
+			log.Errorf("[%s] failed to get block %d: %s", coinType, seq, err)
+			return
+		}
+
+		var found []payment
+		for _, tx := range b.Body.Transactions {
+			owners, err := inputOwners(context.Background(), c, coinType, tx)
+			if err != nil {
+				log.Errorf("[%s] failed to get inputs of transaction %s: %s", coinType, tx.Hash, err)
+				return
+			}
+			found = append(found, txPayments(coinType, seq, tx, owners)...)
+		}
+
+		// handlers only get the payments of a block once it could be read entirely
+		for _, p := range found {
+			for _, f := range handlers {
+				f(p)
+			}
+		}
+
+		ps.Lock()
+		ps.scanned[coinType] = seq
+		ps.Unlock()
+	}
+}
+
+// inputOwners returns the addresses owning the outputs a transaction spends
+func inputOwners(ctx context.Context, c *api.Client, coinType string, tx visor.ReadableTransaction) (map[string]bool, error) {
+	owners := make(map[string]bool)
+	for _, in := range tx.In {
+		ux, err := getUxOut(ctx, c, coinType, in)
+		if err != nil {
+			return nil, err
+		}
+		owners[ux.OwnerAddress] = true
+	}
+	return owners, nil
+}
+
+// txPayments returns the outputs of a transaction in block seq, but the change to its senders
+func txPayments(coinType string, seq uint64, tx visor.ReadableTransaction, senders map[string]bool) []payment {
+	var ret []payment
+	for _, o := range tx.Out {
+		if senders[o.Address] {
+			continue
+		}
+		ret = append(ret, payment{
+			CoinType: coinType,
+			Address:  o.Address,
+			Txid:     tx.Hash,
+			Coins:    o.Coins,
+			Hours:    o.Hours,
+			BlockSeq: seq,
+		})
+	}
+	return ret
+}
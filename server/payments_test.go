@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+	"github.com/skycoin/skycoin/src/visor"
+)
+
+func TestTxPayments(t *testing.T) {
+	tx := visor.ReadableTransaction{
+		Hash: "tx",
+		In:   []string{"ux1", "ux2"},
+		Out: []visor.ReadableTransactionOutput{
+			{Address: "merchant", Coins: "2.000000", Hours: 1},
+			{Address: "change", Coins: "7.000000", Hours: 5},
+		},
+	}
+
+	ps := txPayments("skycoin", 10, tx, map[string]bool{"sender": true, "change": true})
+	if len(ps) != 1 {
+		t.Fatalf("change to the sender is not a payment, got %+v", ps)
+	}
+	if p := ps[0]; p.Address != "merchant" || p.Coins != "2.000000" || p.Txid != "tx" || p.BlockSeq != 10 {
+		t.Fatalf("unexpected payment %+v", p)
+	}
+
+	if ps := txPayments("skycoin", 10, tx, nil); len(ps) != 2 {
+		t.Fatalf("every output of a transaction without known senders is a payment, got %+v", ps)
+	}
+}
+
+func TestPaymentScannerFirstScan(t *testing.T) {
+	var mu sync.Mutex
+	var seqs []string
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seqs = append(seqs, r.URL.Query().Get("seq"))
+		mu.Unlock()
+		w.Write([]byte(`{"header": {"seq": 0}, "body": {"txns": []}}`))
+	}))
+	defer node.Close()
+	u, _ := url.Parse(node.URL)
+
+	defer func(c *coinRegistry, sc serverConfig) { coins, cfg = c, sc }(coins, cfg)
+	coins = &coinRegistry{list: skywallet.CoinMetas{
+		{NameInEnglish: "skycoin", Symbol: "SKY", WebInterfacePort: u.Port()},
+	}}
+	cfg = defaultConfig()
+	cfg.NodeServer = "http://127.0.0.1"
+
+	// the watcher first saw block 10, blocks 11 and 12 showed up in the same poll
+	ps := newPaymentScanner(100, func(coinType string) (uint64, bool) { return 10, true })
+	ps.onPayment(func(p payment) {})
+	ps.scan("skycoin", 12)
+
+	if !reflect.DeepEqual(seqs, []string{"11", "12"}) {
+		t.Fatalf("the first scan should start after the first block seen, scanned %v", seqs)
+	}
+
+	seqs = nil
+	ps.scan("skycoin", 13)
+	if !reflect.DeepEqual(seqs, []string{"13"}) {
+		t.Fatalf("only the new block should be scanned, scanned %v", seqs)
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+	log "github.com/sirupsen/logrus"
+	"github.com/skycoin/skycoin/src/wallet"
+)
+
+const defaultCryptoCompareURL = "https://min-api.cryptocompare.com/data/pricemulti"
+
+// priceProvider fetches prices of coins, keyed by symbol then fiat currency. Symbols a provider
+// doesn't know are left out of the result, they are then looked up in the next provider
+type priceProvider interface {
+	name() string
+	fetch(symbols, fiats []string) (map[string]map[string]float64, error)
+
+	// mappedOnly is true for market data providers, which only get coins mapped to them by
+	// price-symbols: tickers of most forks also belong to unrelated coins listed there
+	mappedOnly() bool
+}
+
+// priceSymbol maps a coin to the price source it is fetched from and its ticker there
+type priceSymbol struct {
+	source string
+	ticker string
+}
+
+// cryptoCompareProvider gets prices from the cryptocompare pricemulti API
+type cryptoCompareProvider struct {
+	url    string
+	client *http.Client
+}
+
+func (p cryptoCompareProvider) name() string {
+	return "cryptocompare"
+}
+
+func (p cryptoCompareProvider) mappedOnly() bool {
+	return true
+}
+
+func (p cryptoCompareProvider) fetch(symbols, fiats []string) (map[string]map[string]float64, error) {
+	q := url.Values{}
+	q.Set("fsyms", strings.Join(symbols, ","))
+	q.Set("tsyms", strings.Join(fiats, ","))
+
+	resp, err := p.client.Get(p.url + "?" + q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodePrices(b)
+}
+
+// filePriceProvider reads prices from a JSON file, for coins without market data, e.g,
+//
+//	{"SC2": {"CNY": 0.12, "USD": 0.018}}
+type filePriceProvider struct {
+	file string
+}
+
+func (p filePriceProvider) name() string {
+	return "file"
+}
+
+func (p filePriceProvider) mappedOnly() bool {
+	return false
+}
+
+func (p filePriceProvider) fetch(symbols, fiats []string) (map[string]map[string]float64, error) {
+	b, err := ioutil.ReadFile(p.file)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodePrices(b)
+}
+
+// decodePrices decodes prices keyed by symbol then fiat, entries that are not prices,
+// e.g, error messages, are skipped
+func decodePrices(b []byte) (map[string]map[string]float64, error) {
+	raw := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]map[string]float64, len(raw))
+	for symbol, v := range raw {
+		var p map[string]float64
+		if err := json.Unmarshal(v, &p); err != nil {
+			continue
+		}
+		ret[strings.ToUpper(symbol)] = p
+	}
+
+	return ret, nil
+}
+
+// parsePriceSources parses price sources in the form cryptocompare,cryptocompare=<url>,file=<path>
+func parsePriceSources(s string) ([]priceProvider, error) {
+	var providers []priceProvider
+	for _, source := range strings.Split(s, ",") {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+
+		kv := strings.SplitN(source, "=", 2)
+		switch kv[0] {
+		case "cryptocompare":
+			u := defaultCryptoCompareURL
+			if len(kv) == 2 {
+				u = kv[1]
+			}
+			providers = append(providers, cryptoCompareProvider{
+				url:    u,
+				client: &http.Client{Timeout: 10 * time.Second},
+			})
+		case "file":
+			if len(kv) != 2 || kv[1] == "" {
+				return nil, fmt.Errorf("price source %q has no file", source)
+			}
+			providers = append(providers, filePriceProvider{file: kv[1]})
+		default:
+			return nil, fmt.Errorf("unknown price source %q", source)
+		}
+	}
+
+	return providers, nil
+}
+
+// parsePriceSymbols parses price symbols in the form SYMBOL=source:TICKER, e.g, SKY=cryptocompare:SKY,
+// the ticker defaults to the symbol of the coin
+func parsePriceSymbols(s string) (map[string]priceSymbol, error) {
+	symbols := make(map[string]priceSymbol)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid price symbol %q", entry)
+		}
+
+		symbol := strings.ToUpper(kv[0])
+		st := strings.SplitN(kv[1], ":", 2)
+		ps := priceSymbol{source: st[0], ticker: symbol}
+		if len(st) == 2 {
+			ps.ticker = strings.ToUpper(st[1])
+		}
+		if ps.source != "cryptocompare" && ps.source != "file" {
+			return nil, fmt.Errorf("unknown price source of price symbol %q", entry)
+		}
+		if ps.ticker == "" {
+			return nil, fmt.Errorf("invalid price symbol %q", entry)
+		}
+
+		symbols[symbol] = ps
+	}
+
+	return symbols, nil
+}
+
+// parseCodes returns the upper cased codes of a comma separated list, i.e, symbols or fiat currencies
+func parseCodes(s string) []string {
+	var codes []string
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.ToUpper(strings.TrimSpace(c)); c != "" {
+			codes = append(codes, c)
+		}
+	}
+	return codes
+}
+
+// priceService keeps the last known price of each enabled coin, refreshed periodically.
+// Prices older than maxAge are stale, they are no longer served
+type priceService struct {
+	providers []priceProvider
+	symbols   map[string]priceSymbol
+	fiats     []string
+	interval  time.Duration
+	maxAge    time.Duration
+
+	sync.RWMutex
+	prices map[string]map[string]skywallet.Price
+}
+
+func newPriceService(providers []priceProvider, symbols map[string]priceSymbol, fiats []string, interval, maxAge time.Duration) *priceService {
+	return &priceService{
+		providers: providers,
+		symbols:   symbols,
+		fiats:     fiats,
+		interval:  interval,
+		maxAge:    maxAge,
+		prices:    make(map[string]map[string]skywallet.Price),
+	}
+}
+
+// run refreshes prices until quit is closed
+func (ps *priceService) run(quit chan struct{}) {
+	ps.refresh()
+
+	t := time.NewTicker(ps.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-t.C:
+			ps.refresh()
+		}
+	}
+}
+
+// refresh asks each provider in turn for the symbols the previous ones didn't know, coins mapped
+// by price-symbols only go to their source, with their ticker there. Prices that can't be fetched
+// keep their last known value until they are stale
+func (ps *priceService) refresh() {
+	seen := make(map[string]bool)
+	var missing []string
+	for _, cm := range coins.enabled() {
+		symbol := strings.ToUpper(cm.Symbol)
+		if !seen[symbol] {
+			seen[symbol] = true
+			missing = append(missing, symbol)
+		}
+	}
+	sort.Strings(missing)
+
+	now := time.Now().Unix()
+	for _, p := range ps.providers {
+		if len(missing) == 0 {
+			break
+		}
+
+		// ticker -> symbols of the coins asked to p
+		tickers := make(map[string][]string)
+		var asked []string
+		for _, symbol := range missing {
+			ticker := symbol
+			if m, ok := ps.symbols[symbol]; ok {
+				if m.source != p.name() {
+					continue
+				}
+				ticker = m.ticker
+			} else if p.mappedOnly() {
+				continue
+			}
+			if len(tickers[ticker]) == 0 {
+				asked = append(asked, ticker)
+			}
+			tickers[ticker] = append(tickers[ticker], symbol)
+		}
+		if len(asked) == 0 {
+			continue
+		}
+
+		fetched, err := p.fetch(asked, ps.fiats)
+		if err != nil {
+			log.Warnf("failed to fetch prices from %s: %s", p.name(), err)
+			continue
+		}
+
+		found := make(map[string]map[string]float64)
+		for ticker, symbols := range tickers {
+			if fp, ok := fetched[ticker]; ok {
+				for _, symbol := range symbols {
+					found[symbol] = fp
+				}
+			}
+		}
+
+		var left []string
+		for _, symbol := range missing {
+			fp, ok := found[symbol]
+			if !ok {
+				left = append(left, symbol)
+				continue
+			}
+
+			ps.Lock()
+			if ps.prices[symbol] == nil {
+				ps.prices[symbol] = make(map[string]skywallet.Price)
+			}
+			for _, fiat := range ps.fiats {
+				if v, ok := fp[fiat]; ok {
+					ps.prices[symbol][fiat] = skywallet.Price{
+						Symbol:    symbol,
+						Fiat:      fiat,
+						Price:     v,
+						Source:    p.name(),
+						UpdatedAt: now,
+					}
+				}
+			}
+			ps.Unlock()
+		}
+		missing = left
+	}
+
+	if len(missing) > 0 {
+		log.Debugf("no price source for %s", strings.Join(missing, ","))
+	}
+}
+
+func (ps *priceService) supportsFiat(fiat string) bool {
+	for _, f := range ps.fiats {
+		if f == fiat {
+			return true
+		}
+	}
+	return false
+}
+
+// price returns the last known price of symbol in fiat, unless it is stale
+func (ps *priceService) price(symbol, fiat string) (skywallet.Price, bool) {
+	ps.RLock()
+	defer ps.RUnlock()
+
+	p, ok := ps.prices[strings.ToUpper(symbol)][strings.ToUpper(fiat)]
+	if !ok || time.Since(time.Unix(p.UpdatedAt, 0)) > ps.maxAge {
+		return skywallet.Price{}, false
+	}
+	return p, true
+}
+
+// pricesHandler returns the known prices of the given symbols, all coins by default,
+// in the given fiat currencies, all configured ones by default
+// example: /prices?symbols=SKY,MZC&fiat=CNY
+func pricesHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	fiats := parseCodes(values.Get("fiat"))
+	if len(fiats) == 0 {
+		fiats = prices.fiats
+	}
+	for _, fiat := range fiats {
+		if !prices.supportsFiat(fiat) {
+			http.Error(w, fmt.Sprintf("fiat currency %s is not supported", fiat), http.StatusBadRequest)
+			return
+		}
+	}
+
+	symbols := parseCodes(values.Get("symbols"))
+	if len(symbols) == 0 {
+		for _, cm := range coins.enabled() {
+			symbols = append(symbols, strings.ToUpper(cm.Symbol))
+		}
+		sort.Strings(symbols)
+	}
+
+	ret := []skywallet.Price{}
+	for _, symbol := range symbols {
+		for _, fiat := range fiats {
+			if p, ok := prices.price(symbol, fiat); ok {
+				ret = append(ret, p)
+			}
+		}
+	}
+
+	bytes, err := json.MarshalIndent(ret, "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal prices: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+}
+
+// fiatBalance is the value of a balance in a fiat currency, see withFiatBalance
+type fiatBalance struct {
+	skywallet.Price
+	Confirmed string `json:"confirmed"`
+	Predicted string `json:"predicted"`
+}
+
+// withFiatBalance adds the value of the getBalance response b in fiat to it
+func withFiatBalance(coinType, fiat string, b []byte) ([]byte, int, error) {
+	fiat = strings.ToUpper(fiat)
+	if !prices.supportsFiat(fiat) {
+		return nil, http.StatusBadRequest, fmt.Errorf("fiat currency %s is not supported", fiat)
+	}
+
+	cm, _ := coins.get(coinType)
+	p, ok := prices.price(cm.Symbol, fiat)
+	if !ok {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("[%s] no %s price is available", coinType, fiat)
+	}
+
+	var balance wallet.BalancePair
+	if err := json.Unmarshal(b, &balance); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// balances are in droplets, 1 coin is 1e6 droplets
+	value := func(droplets uint64) string {
+		return fmt.Sprintf("%.2f", float64(droplets)/1e6*p.Price)
+	}
+
+	ret := struct {
+		wallet.BalancePair
+		Fiat fiatBalance `json:"fiat"`
+	}{
+		BalancePair: balance,
+		Fiat: fiatBalance{
+			Price:     p,
+			Confirmed: value(balance.Confirmed.Coins),
+			Predicted: value(balance.Predicted.Coins),
+		},
+	}
+
+	b, err := json.MarshalIndent(ret, "", "    ")
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return b, http.StatusOK, nil
+}
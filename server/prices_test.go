@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+)
+
+type fakePriceProvider struct {
+	source string
+	mapped bool
+	prices map[string]map[string]float64
+	err    error
+	asked  *[]string
+}
+
+func (p fakePriceProvider) name() string {
+	if p.source != "" {
+		return p.source
+	}
+	return "fake"
+}
+
+func (p fakePriceProvider) fetch(symbols, fiats []string) (map[string]map[string]float64, error) {
+	if p.asked != nil {
+		*p.asked = append(*p.asked, symbols...)
+	}
+	return p.prices, p.err
+}
+
+func (p fakePriceProvider) mappedOnly() bool {
+	return p.mapped
+}
+
+func TestParsePriceSources(t *testing.T) {
+	providers, err := parsePriceSources("cryptocompare, file=prices.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != 2 || providers[0].name() != "cryptocompare" || providers[1].name() != "file" {
+		t.Fatalf("unexpected providers %v", providers)
+	}
+
+	for _, s := range []string{"coinmarketcap", "file", "file="} {
+		if _, err := parsePriceSources(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+func TestParsePriceSymbols(t *testing.T) {
+	symbols, err := parsePriceSymbols("sky=cryptocompare, ARC=cryptocompare:ARCX, SC2=file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]priceSymbol{
+		"SKY": {source: "cryptocompare", ticker: "SKY"},
+		"ARC": {source: "cryptocompare", ticker: "ARCX"},
+		"SC2": {source: "file", ticker: "SC2"},
+	}
+	if !reflect.DeepEqual(symbols, expected) {
+		t.Fatalf("unexpected symbols %v", symbols)
+	}
+
+	for _, s := range []string{"SKY", "=cryptocompare", "SKY=coinmarketcap", "SKY=cryptocompare:"} {
+		if _, err := parsePriceSymbols(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+func TestFilePriceProvider(t *testing.T) {
+	f, err := ioutil.TempFile("", "superwallet-prices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`{"sc2": {"CNY": 0.12}, "Response": "Error"}`)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prices, err := filePriceProvider{file: f.Name()}.fetch(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 1 || prices["SC2"]["CNY"] != 0.12 {
+		t.Fatalf("unexpected prices %v", prices)
+	}
+}
+
+func TestPriceServiceRefresh(t *testing.T) {
+	defer func(c *coinRegistry) { coins = c }(coins)
+	coins = &coinRegistry{list: skywallet.CoinMetas{
+		{NameInEnglish: "skycoin", Symbol: "SKY"},
+		{NameInEnglish: "shellcoin", Symbol: "SC2"},
+	}}
+
+	ps := newPriceService([]priceProvider{
+		fakePriceProvider{err: errors.New("down")},
+		fakePriceProvider{prices: map[string]map[string]float64{"SKY": {"CNY": 10, "EUR": 1}}},
+		fakePriceProvider{prices: map[string]map[string]float64{"SKY": {"CNY": 20}, "SC2": {"CNY": 0.1}}},
+	}, nil, []string{"CNY"}, time.Minute, time.Hour)
+
+	ps.refresh()
+
+	if p, ok := ps.price("sky", "cny"); !ok || p.Price != 10 {
+		t.Fatalf("the first provider knowing a symbol should win, got %+v", p)
+	}
+	if p, ok := ps.price("SC2", "CNY"); !ok || p.Price != 0.1 {
+		t.Fatalf("missing symbols should be looked up in the next provider, got %+v", p)
+	}
+	if _, ok := ps.price("SKY", "EUR"); ok {
+		t.Fatal("only configured fiat currencies should be kept")
+	}
+}
+
+func TestPriceServiceSymbols(t *testing.T) {
+	defer func(c *coinRegistry) { coins = c }(coins)
+	coins = &coinRegistry{list: skywallet.CoinMetas{
+		{NameInEnglish: "skycoin", Symbol: "SKY"},
+		{NameInEnglish: "aynrandcoin", Symbol: "ARC"},
+		{NameInEnglish: "shellcoin", Symbol: "SC2"},
+	}}
+
+	// the market lists an unrelated ARC, aynrandcoin isn't mapped to it
+	var asked []string
+	market := fakePriceProvider{source: "cryptocompare", mapped: true, asked: &asked, prices: map[string]map[string]float64{
+		"SKYX": {"CNY": 10},
+		"ARC":  {"CNY": 1000},
+	}}
+	file := fakePriceProvider{source: "file", prices: map[string]map[string]float64{
+		"ARC": {"CNY": 0.5},
+		"SC2": {"CNY": 0.1},
+	}}
+
+	ps := newPriceService([]priceProvider{market, file}, map[string]priceSymbol{
+		"SKY": {source: "cryptocompare", ticker: "SKYX"},
+	}, []string{"CNY"}, time.Minute, time.Hour)
+	ps.refresh()
+
+	if !reflect.DeepEqual(asked, []string{"SKYX"}) {
+		t.Fatalf("only mapped coins should be sent to the market, with their ticker, got %v", asked)
+	}
+	if p, ok := ps.price("SKY", "CNY"); !ok || p.Price != 10 || p.Symbol != "SKY" {
+		t.Fatalf("mapped coin should get the price of its ticker, got %+v", p)
+	}
+	if p, ok := ps.price("ARC", "CNY"); !ok || p.Price != 0.5 {
+		t.Fatalf("unmapped coin should get its price from the file, got %+v", p)
+	}
+
+	// prices that stopped updating are stale
+	ps.Lock()
+	p := ps.prices["SC2"]["CNY"]
+	p.UpdatedAt = time.Now().Add(-2 * time.Hour).Unix()
+	ps.prices["SC2"]["CNY"] = p
+	ps.Unlock()
+	if _, ok := ps.price("SC2", "CNY"); ok {
+		t.Fatal("stale price should not be served")
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	apnsHost        = "https://api.push.apple.com"
+	apnsSandboxHost = "https://api.sandbox.push.apple.com"
+	fcmHost         = "https://fcm.googleapis.com"
+	fcmTokenURL     = "https://oauth2.googleapis.com/token"
+	fcmScope        = "https://www.googleapis.com/auth/firebase.messaging"
+
+	// APNs rejects provider tokens older than an hour
+	apnsTokenTTL = 50 * time.Minute
+
+	// FCM access tokens are renewed this long before they expire
+	fcmTokenMargin = 5 * time.Minute
+)
+
+// errInvalidToken is returned by senders when the device token is no longer valid
+var errInvalidToken = errors.New("invalid device token")
+
+// notification is sent to a device when a payment to one of its addresses is confirmed
+type notification struct {
+	Token    string  `json:"token"`
+	Platform string  `json:"platform"`
+	Title    string  `json:"title"`
+	Body     string  `json:"body"`
+	Payment  payment `json:"payment"`
+}
+
+// notificationSender delivers notifications to the devices of a platform
+type notificationSender interface {
+	send(n notification) error
+}
+
+// newSenders returns the senders that are configured, keyed by platform. The log and webhook
+// platforms are for testing, anyone can subscribe made up tokens to them so they are off by default
+func newSenders() (map[string]notificationSender, error) {
+	senders := make(map[string]notificationSender)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	if cfg.NotifyTestPlatforms {
+		senders["log"] = logSender{}
+		if cfg.NotifyWebhookURL != "" {
+			senders["webhook"] = webhookSender{url: cfg.NotifyWebhookURL, client: client}
+		}
+	}
+
+	if cfg.FCMCredentialsFile != "" {
+		creds, key, err := loadFCMCredentials(cfg.FCMCredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		senders["fcm"] = &fcmSender{
+			host:   fcmHost,
+			creds:  creds,
+			key:    key,
+			client: client,
+		}
+	}
+
+	if cfg.APNsKeyFile != "" {
+		key, err := loadAPNsKey(cfg.APNsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		host := apnsHost
+		if cfg.APNsSandbox {
+			host = apnsSandboxHost
+		}
+
+		senders["apns"] = &apnsSender{
+			host:   host,
+			keyID:  cfg.APNsKeyID,
+			teamID: cfg.APNsTeamID,
+			topic:  cfg.APNsTopic,
+			key:    key,
+			client: client,
+		}
+	}
+
+	return senders, nil
+}
+
+// logSender only logs notifications, for testing
+type logSender struct{}
+
+func (logSender) send(n notification) error {
+	log.WithField("coin", n.Payment.CoinType).Infof("notification to %s: %s", n.Token, n.Body)
+	return nil
+}
+
+// webhookSender posts notifications as JSON to a URL, for testing or custom delivery
+type webhookSender struct {
+	url    string
+	client *http.Client
+}
+
+func (s webhookSender) send(n notification) error {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// fcmCredentials is the service account key file downloaded from the Firebase console
+type fcmCredentials struct {
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+func loadFCMCredentials(file string) (*fcmCredentials, *rsa.PrivateKey, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read FCM credentials: %v", err)
+	}
+
+	var c fcmCredentials
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse FCM credentials %s: %v", file, err)
+	}
+
+	if c.ProjectID == "" || c.ClientEmail == "" {
+		return nil, nil, fmt.Errorf("FCM credentials %s are not a service account key", file)
+	}
+	if c.TokenURI == "" {
+		c.TokenURI = fcmTokenURL
+	}
+
+	block, _ := pem.Decode([]byte(c.PrivateKey))
+	if block == nil {
+		return nil, nil, fmt.Errorf("private key of FCM credentials %s is not PEM encoded", file)
+	}
+
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid private key in FCM credentials %s: %v", file, err)
+	}
+
+	key, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("private key of FCM credentials %s is not an RSA key", file)
+	}
+	return &c, key, nil
+}
+
+// fcmSender sends notifications with the Firebase Cloud Messaging HTTP v1 API, authenticated with
+// an OAuth2 access token obtained with a JWT signed by the service account key
+type fcmSender struct {
+	host   string
+	creds  *fcmCredentials
+	key    *rsa.PrivateKey
+	client *http.Client
+
+	sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// accessToken returns an OAuth2 access token of the service account, renewed before it expires
+func (s *fcmSender) accessToken() (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.token != "" && time.Now().Before(s.expires) {
+		return s.token, nil
+	}
+
+	now := time.Now()
+	enc := base64.RawURLEncoding
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.creds.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   s.creds.ClientEmail,
+		"scope": fcmScope,
+		"aud":   s.creds.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.client.PostForm(s.creds.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + enc.EncodeToString(sig)},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to get FCM access token: %s: %s", resp.Status, b)
+	}
+
+	result := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	s.token = result.AccessToken
+	s.expires = now.Add(time.Duration(result.ExpiresIn)*time.Second - fcmTokenMargin)
+
+	return s.token, nil
+}
+
+func (s *fcmSender) send(n notification) error {
+	token, err := s.accessToken()
+	if err != nil {
+		return err
+	}
+
+	// data values of the v1 API must be strings
+	data := make(map[string]string)
+	b, err := json.Marshal(n.Payment)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	for k, v := range fields {
+		data[k] = fmt.Sprint(v)
+	}
+
+	b, err = json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token": n.Token,
+			"notification": map[string]string{
+				"title": n.Title,
+				"body":  n.Body,
+			},
+			"data": data,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/v1/projects/%s/messages:send", s.host, s.creds.ProjectID), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	result := struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}{}
+	json.NewDecoder(resp.Body).Decode(&result)
+
+	for _, d := range result.Error.Details {
+		if d.ErrorCode == "UNREGISTERED" {
+			return errInvalidToken
+		}
+	}
+	if result.Error.Status == "NOT_FOUND" {
+		return errInvalidToken
+	}
+	return fmt.Errorf("fcm error %s: %s", resp.Status, result.Error.Message)
+}
+
+// apnsSender sends notifications with the Apple Push Notification service HTTP/2 API,
+// authenticated with a provider token signed by the .p8 key of the team
+type apnsSender struct {
+	host   string
+	keyID  string
+	teamID string
+	topic  string
+	key    *ecdsa.PrivateKey
+	client *http.Client
+
+	sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+func loadAPNsKey(file string) (*ecdsa.PrivateKey, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read APNs key: %v", err)
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("APNs key %s is not PEM encoded", file)
+	}
+
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APNs key %s: %v", file, err)
+	}
+
+	key, ok := k.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("APNs key %s is not an ECDSA key", file)
+	}
+	return key, nil
+}
+
+// providerToken returns a JWT signed with ES256, renewed before APNs considers it expired
+func (s *apnsSender) providerToken() (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.token != "" && time.Since(s.issuedAt) < apnsTokenTTL {
+		return s.token, nil
+	}
+
+	now := time.Now()
+	enc := base64.RawURLEncoding
+
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "kid": s.keyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{"iss": s.teamID, "iat": now.Unix()})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	// JWS signatures are r and s as fixed size big endian integers
+	size := (s.key.Curve.Params().BitSize + 7) / 8
+	sig := make([]byte, 2*size)
+	rb, sb := r.Bytes(), ss.Bytes()
+	copy(sig[size-len(rb):size], rb)
+	copy(sig[2*size-len(sb):], sb)
+
+	s.token = unsigned + "." + enc.EncodeToString(sig)
+	s.issuedAt = now
+
+	return s.token, nil
+}
+
+func (s *apnsSender) send(n notification) error {
+	// subscriptions saved before tokens were validated
+	if _, err := hex.DecodeString(n.Token); n.Token == "" || err != nil {
+		return errInvalidToken
+	}
+
+	token, err := s.providerToken()
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{
+				"title": n.Title,
+				"body":  n.Body,
+			},
+			"sound": "default",
+		},
+		"payment": n.Payment,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.host+"/3/device/"+n.Token, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("apns-topic", s.topic)
+	req.Header.Set("apns-push-type", "alert")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	reason := struct {
+		Reason string `json:"reason"`
+	}{}
+	json.NewDecoder(resp.Body).Decode(&reason)
+
+	if resp.StatusCode == http.StatusGone || reason.Reason == "BadDeviceToken" || reason.Reason == "Unregistered" {
+		return errInvalidToken
+	}
+	return fmt.Errorf("apns error %s: %s", resp.Status, reason.Reason)
+}
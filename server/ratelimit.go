@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/time/rate"
+)
+
+// apiKeyHeader optionally identifies a client, requests carrying it are rate limited per key as well as per IP
+const apiKeyHeader = "X-Api-Key"
+
+// limit is the token bucket configuration of a route
+type limit struct {
+	rate  rate.Limit
+	burst int
+}
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter keeps a token bucket per client and route
+type rateLimiter struct {
+	defaultLimit limit
+	routeLimits  map[string]limit
+
+	sync.Mutex
+	visitors map[string]*visitor
+}
+
+func newRateLimiter(defaultLimit limit, routeLimits map[string]limit) *rateLimiter {
+	return &rateLimiter{
+		defaultLimit: defaultLimit,
+		routeLimits:  routeLimits,
+		visitors:     make(map[string]*visitor),
+	}
+}
+
+// parseRouteLimits parses route limits in the form route=rate:burst,route=rate:burst
+func parseRouteLimits(s string) (map[string]limit, error) {
+	limits := make(map[string]limit)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid route limit %q", entry)
+		}
+
+		rb := strings.SplitN(kv[1], ":", 2)
+		if len(rb) != 2 {
+			return nil, fmt.Errorf("invalid route limit %q", entry)
+		}
+
+		r, err := strconv.ParseFloat(rb[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate of route limit %q: %v", entry, err)
+		}
+
+		b, err := strconv.Atoi(rb[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid burst of route limit %q: %v", entry, err)
+		}
+
+		limits[kv[0]] = limit{rate: rate.Limit(r), burst: b}
+	}
+
+	return limits, nil
+}
+
+// allow takes a token from the bucket of client on route, it returns how long
+// the client should wait before retrying when the bucket is empty
+func (rl *rateLimiter) allow(client, route string) (bool, time.Duration) {
+	return rl.allowAll([]string{client}, route)
+}
+
+// allowAll takes a token from the buckets of all clients on route, or from none of them when
+// one of the buckets is empty, i.e, the IP of a request isn't charged when its API key is limited
+func (rl *rateLimiter) allowAll(clients []string, route string) (bool, time.Duration) {
+	l, ok := rl.routeLimits[route]
+	if !ok {
+		l = rl.defaultLimit
+	}
+
+	if l.rate <= 0 {
+		return true, 0
+	}
+
+	now := time.Now()
+	limiters := make([]*rate.Limiter, len(clients))
+
+	rl.Lock()
+	for i, client := range clients {
+		key := client + " " + route
+		v, ok := rl.visitors[key]
+		if !ok {
+			v = &visitor{limiter: rate.NewLimiter(l.rate, l.burst)}
+			rl.visitors[key] = v
+		}
+		v.lastSeen = now
+		limiters[i] = v.limiter
+	}
+	rl.Unlock()
+
+	reservations := make([]*rate.Reservation, 0, len(limiters))
+	cancel := func() {
+		for _, res := range reservations {
+			res.CancelAt(now)
+		}
+	}
+
+	for _, lim := range limiters {
+		res := lim.ReserveN(now, 1)
+		if !res.OK() {
+			cancel()
+			return false, time.Second
+		}
+		reservations = append(reservations, res)
+
+		if d := res.DelayFrom(now); d > 0 {
+			cancel()
+			return false, d
+		}
+	}
+
+	return true, 0
+}
+
+// cleanup forgets clients that haven't been seen for idle, until quit is closed
+func (rl *rateLimiter) cleanup(idle time.Duration, quit chan struct{}) {
+	t := time.NewTicker(idle)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-t.C:
+			rl.Lock()
+			for k, v := range rl.visitors {
+				if time.Since(v.lastSeen) > idle {
+					delete(rl.visitors, k)
+				}
+			}
+			rl.Unlock()
+		}
+	}
+}
+
+func clientIP(r *http.Request) string {
+	if cfg.TrustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			// the right most address is the one the trusted proxy appended, the others come from the
+			// client, which could change them on each request to get around the per IP limit
+			addrs := strings.Split(fwd, ",")
+			return strings.TrimSpace(addrs[len(addrs)-1])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// middleware rejects requests over the rate limit with 429 and requests with too many addresses with 400
+func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		// clients are always limited per IP, otherwise rotating API keys would bypass the limit
+		clients := []string{"ip:" + clientIP(r)}
+		if key := r.Header.Get(apiKeyHeader); key != "" {
+			clients = append(clients, "key:"+key)
+		}
+
+		if ok, wait := rl.allowAll(clients, route); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+
+		if addrs := r.URL.Query().Get("addrs"); cfg.MaxAddrs > 0 && addrs != "" {
+			if n := strings.Count(addrs, ",") + 1; n > cfg.MaxAddrs {
+				http.Error(w, fmt.Sprintf("too many addresses: %d, at most %d are allowed", n, cfg.MaxAddrs), http.StatusBadRequest)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
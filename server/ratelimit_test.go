@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/time/rate"
+)
+
+func TestParseRouteLimits(t *testing.T) {
+	limits, err := parseRouteLimits("/{coinType}/injectTransaction=1:5, /{coinType}/getBalance=0.5:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := limits["/{coinType}/injectTransaction"]; l.rate != 1 || l.burst != 5 {
+		t.Fatalf("unexpected limit %+v", l)
+	}
+	if l := limits["/{coinType}/getBalance"]; l.rate != 0.5 || l.burst != 2 {
+		t.Fatalf("unexpected limit %+v", l)
+	}
+
+	for _, s := range []string{"/a", "/a=1", "/a=x:1", "/a=1:x"} {
+		if _, err := parseRouteLimits(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	rl := newRateLimiter(limit{rate: 1, burst: 2}, map[string]limit{
+		"/slow":      {rate: rate.Limit(0.01), burst: 1},
+		"/unlimited": {rate: 0},
+	})
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := rl.allow("ip:1.2.3.4", "/fast"); !ok {
+			t.Fatalf("request %d should be allowed by the burst", i)
+		}
+	}
+
+	ok, wait := rl.allow("ip:1.2.3.4", "/fast")
+	if ok || wait <= 0 {
+		t.Fatalf("request over the burst should be rejected with a wait time, got %v %v", ok, wait)
+	}
+
+	// buckets are per client and per route
+	if ok, _ := rl.allow("ip:5.6.7.8", "/fast"); !ok {
+		t.Fatal("another client should be allowed")
+	}
+	if ok, _ := rl.allow("ip:1.2.3.4", "/slow"); !ok {
+		t.Fatal("another route should be allowed")
+	}
+	if ok, _ := rl.allow("ip:1.2.3.4", "/slow"); ok {
+		t.Fatal("route limit should override the default limit")
+	}
+
+	for i := 0; i < 100; i++ {
+		if ok, _ := rl.allow("ip:1.2.3.4", "/unlimited"); !ok {
+			t.Fatal("routes with rate 0 are not limited")
+		}
+	}
+}
+
+func TestRateLimiterAllowAll(t *testing.T) {
+	rl := newRateLimiter(limit{rate: rate.Limit(0.01), burst: 1}, nil)
+
+	if ok, _ := rl.allowAll([]string{"ip:1.2.3.4", "key:k"}, "/fast"); !ok {
+		t.Fatal("first request should be allowed")
+	}
+
+	// the key is limited, the IP must not be charged for the refused request
+	if ok, _ := rl.allowAll([]string{"ip:5.6.7.8", "key:k"}, "/fast"); ok {
+		t.Fatal("limited key should be refused")
+	}
+	if ok, _ := rl.allow("ip:5.6.7.8", "/fast"); !ok {
+		t.Fatal("the IP of a request refused because of its key should keep its token")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	defer func(sc serverConfig) {
+		cfg = sc
+	}(cfg)
+	cfg = defaultConfig()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "6.6.6.6, 1.2.3.4")
+
+	if ip := clientIP(r); ip != "10.0.0.1" {
+		t.Errorf("X-Forwarded-For should be ignored without trust-proxy, got %s", ip)
+	}
+
+	cfg.TrustProxy = true
+	if ip := clientIP(r); ip != "1.2.3.4" {
+		t.Errorf("the address appended by the proxy should be used, got %s", ip)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// workers runs background goroutines such as the block watcher, they stop when quit is closed
+type workers struct {
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newWorkers() *workers {
+	return &workers{quit: make(chan struct{})}
+}
+
+func (ws *workers) start(f func(quit chan struct{})) {
+	ws.wg.Add(1)
+	go func() {
+		defer ws.wg.Done()
+		f(ws.quit)
+	}()
+}
+
+// stop tells workers to stop and waits for them until ctx is done
+func (ws *workers) stop(ctx context.Context) error {
+	close(ws.quit)
+
+	done := make(chan struct{})
+	go func() {
+		ws.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitForSignal blocks until SIGINT or SIGTERM is received, or until the server fails,
+// it returns the error of the server then, e.g, when its port is in use
+func waitForSignal(errc chan error) error {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigc)
+
+	select {
+	case sig := <-sigc:
+		log.Infof("received %s, shutting down", sig)
+	case err := <-errc:
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("Failed to start server: %s", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// shutdown stops accepting connections, waits for in-flight requests, e.g, an injectTransaction
+// whose txid the client hasn't received yet, then stops background workers, all within timeout
+func shutdown(timeout time.Duration, ws *workers, servers ...*http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Errorf("failed to drain requests of %s: %s", srv.Addr, err)
+			}
+		}(srv)
+	}
+	wg.Wait()
+
+	if err := ws.stop(ctx); err != nil {
+		log.Errorf("failed to stop background workers: %s", err)
+	}
+
+	log.Info("server stopped")
+
+	if f, ok := log.StandardLogger().Out.(*os.File); ok {
+		f.Sync()
+	}
+}
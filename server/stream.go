@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/skycoin/skycoin/src/visor"
+	"github.com/skycoin/skycoin/src/wallet"
+)
+
+const (
+	// events buffered per stream, streams of clients that can't keep up are closed
+	streamBufferSize = 64
+
+	streamHeartbeat = 15 * time.Second
+
+	// balance requests in flight at most when the balances of streams are checked
+	streamBalanceWorkers = 8
+)
+
+// stream event types
+const (
+	eventUnconfirmed = "unconfirmed"
+	eventConfirmed   = "confirmed"
+	eventBalance     = "balance"
+)
+
+// streamEvent is sent to clients of /{coinType}/stream
+type streamEvent struct {
+	Type     string              `json:"type"`
+	CoinType string              `json:"coinType"`
+	Txid     string              `json:"txid,omitempty"`
+	Address  string              `json:"address,omitempty"`
+	Coins    string              `json:"coins,omitempty"`
+	Hours    uint64              `json:"hours,omitempty"`
+	BlockSeq uint64              `json:"blockSeq,omitempty"`
+	Balance  *wallet.BalancePair `json:"balance,omitempty"`
+}
+
+// streamClient is a connected stream
+type streamClient struct {
+	coinType string
+	addrs    []string
+	addrSet  map[string]bool
+	events   chan streamEvent
+	done     chan struct{}
+
+	closeOnce   sync.Once
+	lastBalance *wallet.BalancePair // only used by the hub
+}
+
+func (sc *streamClient) close() {
+	sc.closeOnce.Do(func() {
+		close(sc.done)
+	})
+}
+
+// send queues an event, it closes the stream when the client doesn't keep up
+func (sc *streamClient) send(e streamEvent) {
+	select {
+	case sc.events <- e:
+	case <-sc.done:
+	default:
+		log.Warnf("[%s] stream is too slow, closing it", sc.coinType)
+		sc.close()
+	}
+}
+
+// streamHub keeps the connected streams, it polls the unconfirmed transactions of coins with
+// streams, and is told about new blocks and payments by the block watcher and payment scanner
+type streamHub struct {
+	interval time.Duration
+	wake     chan struct{} // wakes up runBalanceChecks
+
+	sync.Mutex
+	clients map[string]map[*streamClient]struct{} // keyed by coin
+	pending map[string]map[string]bool            // txids in the pool at the last poll, keyed by coin
+	dirty   map[string]bool                       // coins whose stream balances must be checked
+}
+
+func newStreamHub(interval time.Duration) *streamHub {
+	return &streamHub{
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+		clients:  make(map[string]map[*streamClient]struct{}),
+		pending:  make(map[string]map[string]bool),
+		dirty:    make(map[string]bool),
+	}
+}
+
+func (h *streamHub) count() int {
+	h.Lock()
+	defer h.Unlock()
+
+	n := 0
+	for _, cs := range h.clients {
+		n += len(cs)
+	}
+	return n
+}
+
+func (h *streamHub) add(sc *streamClient) {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.clients[sc.coinType] == nil {
+		h.clients[sc.coinType] = make(map[*streamClient]struct{})
+	}
+	h.clients[sc.coinType][sc] = struct{}{}
+}
+
+func (h *streamHub) remove(sc *streamClient) {
+	h.Lock()
+	defer h.Unlock()
+
+	delete(h.clients[sc.coinType], sc)
+	if len(h.clients[sc.coinType]) == 0 {
+		delete(h.clients, sc.coinType)
+		delete(h.pending, sc.coinType)
+	}
+}
+
+// clientsOf returns the streams of a coin
+func (h *streamHub) clientsOf(coinType string) []*streamClient {
+	h.Lock()
+	defer h.Unlock()
+
+	ret := make([]*streamClient, 0, len(h.clients[coinType]))
+	for sc := range h.clients[coinType] {
+		ret = append(ret, sc)
+	}
+	return ret
+}
+
+// closeAll ends all streams, it is registered with http.Server.RegisterOnShutdown
+// so that streams don't hold up the graceful shutdown
+func (h *streamHub) closeAll() {
+	h.Lock()
+	defer h.Unlock()
+
+	for _, cs := range h.clients {
+		for sc := range cs {
+			sc.close()
+		}
+	}
+}
+
+// run polls the pool of coins with streams until quit is closed
+func (h *streamHub) run(quit chan struct{}) {
+	t := time.NewTicker(h.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-quit:
+			h.closeAll()
+			return
+		case <-t.C:
+			h.Lock()
+			coinTypes := make([]string, 0, len(h.clients))
+			for coinType := range h.clients {
+				coinTypes = append(coinTypes, coinType)
+			}
+			h.Unlock()
+
+			for _, coinType := range coinTypes {
+				h.pollPool(coinType)
+			}
+		}
+	}
+}
+
+// pollPool sends unconfirmed events for transactions that entered the pool since the last poll
+func (h *streamHub) pollPool(coinType string) {
+	c := newNodeClient(coinType)
+
+	var txns []*visor.ReadableUnconfirmedTxn
+	err := observeNodeCall(context.Background(), coinType, "pendingTransactions", func() error {
+		var err error
+		txns, err = c.PendingTransactions()
+		return err
+	})
+	if err != nil {
+		log.Errorf("[%s] failed to get pending transactions: %s", coinType, err)
+		return
+	}
+
+	h.Lock()
+	prev, polled := h.pending[coinType]
+	current := make(map[string]bool, len(txns))
+	for _, txn := range txns {
+		current[txn.Txn.Hash] = true
+	}
+	h.pending[coinType] = current
+	h.Unlock()
+
+	// transactions already in the pool when the coin got its first stream are not new
+	if !polled {
+		return
+	}
+
+	clients := h.clientsOf(coinType)
+	changed := make(map[*streamClient]bool)
+	for _, txn := range txns {
+		if prev[txn.Txn.Hash] {
+			continue
+		}
+
+		// change going back to the sender is not a payment
+		owners, err := inputOwners(context.Background(), c, coinType, txn.Txn)
+		if err != nil {
+			log.Errorf("[%s] failed to get inputs of transaction %s: %s", coinType, txn.Txn.Hash, err)
+			continue
+		}
+
+		for _, p := range txPayments(coinType, 0, txn.Txn, owners) {
+			for _, sc := range clients {
+				if sc.addrSet[p.Address] {
+					sc.send(streamEvent{
+						Type:     eventUnconfirmed,
+						CoinType: coinType,
+						Txid:     p.Txid,
+						Address:  p.Address,
+						Coins:    p.Coins,
+						Hours:    p.Hours,
+					})
+					changed[sc] = true
+				}
+			}
+		}
+	}
+
+	// spends from the addresses of a stream don't have their addresses in the pool, so every
+	// stream checks its balance when the pool changes
+	if len(current) != len(prev) || len(changed) > 0 {
+		h.scheduleBalanceChecks(coinType)
+	}
+}
+
+// onNewBlock is a new block handler of the block watcher
+func (h *streamHub) onNewBlock(coinType string, height uint64) {
+	h.scheduleBalanceChecks(coinType)
+}
+
+// handlePayment is a payment handler of the payment scanner
+func (h *streamHub) handlePayment(p payment) {
+	for _, sc := range h.clientsOf(p.CoinType) {
+		if sc.addrSet[p.Address] {
+			sc.send(streamEvent{
+				Type:     eventConfirmed,
+				CoinType: p.CoinType,
+				Txid:     p.Txid,
+				Address:  p.Address,
+				Coins:    p.Coins,
+				Hours:    p.Hours,
+				BlockSeq: p.BlockSeq,
+			})
+		}
+	}
+}
+
+// scheduleBalanceChecks has the balances of the streams of a coin checked by runBalanceChecks,
+// it doesn't block, so that the block watcher and the pool polling are not held up by slow nodes
+func (h *streamHub) scheduleBalanceChecks(coinType string) {
+	h.Lock()
+	h.dirty[coinType] = true
+	h.Unlock()
+
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runBalanceChecks checks the balances of streams of coins scheduled by scheduleBalanceChecks until quit is closed
+func (h *streamHub) runBalanceChecks(quit chan struct{}) {
+	for {
+		select {
+		case <-quit:
+			return
+		case <-h.wake:
+		}
+
+		h.Lock()
+		dirty := h.dirty
+		h.dirty = make(map[string]bool)
+		h.Unlock()
+
+		for coinType := range dirty {
+			h.checkBalances(coinType)
+		}
+	}
+}
+
+// checkBalances sends balance events to the streams of a coin whose balance changed, streams
+// of the same addresses share a node request and at most streamBalanceWorkers are in flight
+func (h *streamHub) checkBalances(coinType string) {
+	groups := make(map[string][]*streamClient)
+	for _, sc := range h.clientsOf(coinType) {
+		// addresses are normalized, i.e, sorted
+		key := strings.Join(sc.addrs, ",")
+		groups[key] = append(groups[key], sc)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, streamBalanceWorkers)
+	for _, group := range groups {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(group []*streamClient) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			balance, err := streamBalance(coinType, group[0].addrs)
+			if err != nil {
+				log.Errorf("[%s] failed to get balance of stream: %s", coinType, err)
+				return
+			}
+			for _, sc := range group {
+				h.sendBalance(sc, balance)
+			}
+		}(group)
+	}
+	wg.Wait()
+}
+
+// checkBalance sends the balance of a stream if it changed
+func (h *streamHub) checkBalance(sc *streamClient) {
+	balance, err := streamBalance(sc.coinType, sc.addrs)
+	if err != nil {
+		log.Errorf("[%s] failed to get balance of stream: %s", sc.coinType, err)
+		return
+	}
+	h.sendBalance(sc, balance)
+}
+
+func streamBalance(coinType string, addrs []string) (*wallet.BalancePair, error) {
+	c := newNodeClient(coinType)
+
+	var balance *wallet.BalancePair
+	err := observeNodeCall(context.Background(), coinType, "balance", func() error {
+		var err error
+		balance, err = c.Balance(addrs)
+		return err
+	})
+	return balance, err
+}
+
+func (h *streamHub) sendBalance(sc *streamClient, balance *wallet.BalancePair) {
+	h.Lock()
+	changed := !reflect.DeepEqual(sc.lastBalance, balance)
+	sc.lastBalance = balance
+	h.Unlock()
+
+	if changed {
+		sc.send(streamEvent{
+			Type:     eventBalance,
+			CoinType: sc.coinType,
+			Balance:  balance,
+		})
+	}
+}
+
+// streamHandler streams events about addresses as server-sent events, e.g,
+// /skycoin/stream?addrs=a,b sends the current balance, then unconfirmed, confirmed and balance events
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	coinType := vars["coinType"]
+
+	if !isCoinTypeSupported(coinType) {
+		http.Error(w, fmt.Sprintf("%s is not supported", coinType), http.StatusForbidden)
+		return
+	}
+
+	addrs := normalizeAddrs(r.URL.Query().Get("addrs"))
+	if len(addrs) == 0 {
+		http.Error(w, "missing addrs", http.StatusBadRequest)
+		return
+	}
+
+	if streams.count() >= cfg.MaxStreams {
+		http.Error(w, "too many streams, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// streams last longer than the read and write timeouts of the server, the request context
+	// is canceled when the read deadline expires
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Time{}); err != nil {
+		requestLogger(r).Warnf("failed to clear read deadline of stream: %s", err)
+	}
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		requestLogger(r).Warnf("failed to clear write deadline of stream: %s", err)
+	}
+
+	sc := &streamClient{
+		coinType: coinType,
+		addrs:    addrs,
+		addrSet:  make(map[string]bool, len(addrs)),
+		events:   make(chan streamEvent, streamBufferSize),
+		done:     make(chan struct{}),
+	}
+	for _, a := range addrs {
+		sc.addrSet[a] = true
+	}
+
+	streams.add(sc)
+	defer streams.remove(sc)
+	defer sc.close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	go streams.checkBalance(sc)
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sc.done:
+			return
+		case <-heartbeat.C:
+			// keeps proxies from closing idle connections
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e := <-sc.events:
+			b, err := json.Marshal(e)
+			if err != nil {
+				requestLogger(r).Errorf("failed to marshal stream event: %s", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+)
+
+func newTestStreamClient(coinType string, bufSize int, addrs ...string) *streamClient {
+	sc := &streamClient{
+		coinType: coinType,
+		addrs:    addrs,
+		addrSet:  make(map[string]bool),
+		events:   make(chan streamEvent, bufSize),
+		done:     make(chan struct{}),
+	}
+	for _, a := range addrs {
+		sc.addrSet[a] = true
+	}
+	return sc
+}
+
+func TestStreamHubHandlePayment(t *testing.T) {
+	h := newStreamHub(0)
+
+	a := newTestStreamClient("skycoin", 4, "a", "b")
+	b := newTestStreamClient("skycoin", 4, "c")
+	c := newTestStreamClient("mzcoin", 4, "a")
+	h.add(a)
+	h.add(b)
+	h.add(c)
+
+	h.handlePayment(payment{CoinType: "skycoin", Address: "a", Txid: "tx", Coins: "1.000000", BlockSeq: 7})
+
+	if len(a.events) != 1 || len(b.events) != 0 || len(c.events) != 0 {
+		t.Fatalf("unexpected events %d %d %d", len(a.events), len(b.events), len(c.events))
+	}
+	if e := <-a.events; e.Type != eventConfirmed || e.Txid != "tx" || e.BlockSeq != 7 {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	h.remove(a)
+	h.remove(b)
+	if h.count() != 1 {
+		t.Fatalf("expected 1 stream, got %d", h.count())
+	}
+}
+
+func TestStreamClientSlow(t *testing.T) {
+	sc := newTestStreamClient("skycoin", 1, "a")
+
+	sc.send(streamEvent{Type: eventBalance})
+	sc.send(streamEvent{Type: eventBalance})
+
+	select {
+	case <-sc.done:
+	default:
+		t.Fatal("stream of a client that doesn't keep up should be closed")
+	}
+
+	// sending to a closed stream doesn't block
+	sc.send(streamEvent{Type: eventBalance})
+}
+
+func TestStreamHubCloseAll(t *testing.T) {
+	h := newStreamHub(0)
+	sc := newTestStreamClient("skycoin", 1, "a")
+	h.add(sc)
+
+	h.closeAll()
+	h.closeAll()
+
+	select {
+	case <-sc.done:
+	default:
+		t.Fatal("stream should be closed")
+	}
+}
+
+func TestStreamHubScheduleBalanceChecks(t *testing.T) {
+	h := newStreamHub(0)
+
+	// new blocks and pool changes don't wait for the checks, they are coalesced per coin
+	h.onNewBlock("skycoin", 1)
+	h.onNewBlock("skycoin", 2)
+	h.onNewBlock("mzcoin", 1)
+
+	if len(h.wake) != 1 {
+		t.Fatalf("expected a single wake up, got %d", len(h.wake))
+	}
+	if len(h.dirty) != 2 || !h.dirty["skycoin"] || !h.dirty["mzcoin"] {
+		t.Fatalf("unexpected coins to check %v", h.dirty)
+	}
+}
+
+func TestStreamOutlivesReadTimeout(t *testing.T) {
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"confirmed": {"coins": 1000000, "hours": 1}, "predicted": {"coins": 1000000, "hours": 1}}`))
+	}))
+	defer node.Close()
+	u, _ := url.Parse(node.URL)
+
+	defer func(c *coinRegistry, sc serverConfig, h *streamHub) {
+		coins, cfg, streams = c, sc, h
+	}(coins, cfg, streams)
+	coins = &coinRegistry{list: skywallet.CoinMetas{
+		{NameInEnglish: "skycoin", Symbol: "SKY", WebInterfacePort: u.Port()},
+	}}
+	cfg = defaultConfig()
+	cfg.NodeServer = "http://127.0.0.1"
+	streams = newStreamHub(0)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/{coinType}/stream", streamHandler)
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.ReadTimeout = 100 * time.Millisecond
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/skycoin/stream?addrs=a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		s := bufio.NewScanner(resp.Body)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+
+	timeout := time.After(5 * time.Second)
+	for balance := false; !balance; {
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				t.Fatal("stream ended before sending the balance")
+			}
+			balance = strings.HasPrefix(l, "event: balance")
+		case <-timeout:
+			t.Fatal("the balance should be sent")
+		}
+	}
+
+	for open := time.After(5 * srv.Config.ReadTimeout); open != nil; {
+		select {
+		case _, ok := <-lines:
+			if !ok {
+				t.Fatal("stream should outlive the read and write timeouts of the server")
+			}
+		case <-open:
+			open = nil
+		}
+	}
+
+	if streams.count() != 1 {
+		t.Fatalf("expected 1 stream, got %d", streams.count())
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func tlsEnabled() bool {
+	return cfg.TLSCertFile != "" || cfg.ACMEDomains != ""
+}
+
+// newTLSConfig returns the TLS configuration of the server, and the autocert manager when ACME is used,
+// settings have been validated by serverConfig.validate
+func newTLSConfig() (*tls.Config, *autocert.Manager) {
+	tlsConfig := &tls.Config{
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: true,
+	}
+
+	if cfg.ACMEDomains == "" {
+		return tlsConfig, nil
+	}
+
+	var domains []string
+	for _, d := range strings.Split(cfg.ACMEDomains, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Cache:      autocert.DirCache(cfg.ACMECacheDir),
+		Email:      cfg.ACMEEmail,
+	}
+
+	tlsConfig.GetCertificate = m.GetCertificate
+	// needed by the tls-alpn-01 challenge
+	tlsConfig.NextProtos = append(tlsConfig.NextProtos, "h2", "http/1.1", "acme-tls/1")
+
+	return tlsConfig, m
+}
+
+// newRedirectServer returns a plain HTTP server redirecting every request to HTTPS,
+// it also answers ACME http-01 challenges when m is not nil
+func newRedirectServer(m *autocert.Manager) *http.Server {
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = hostname
+		}
+
+		if cfg.Port != "443" {
+			host = net.JoinHostPort(host, cfg.Port)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+
+	if m != nil {
+		h = m.HTTPHandler(h)
+	}
+
+	// the same timeouts as the HTTPS server, idle or slow clients must not hold connections forever
+	return &http.Server{
+		Addr:              net.JoinHostPort(cfg.Host, cfg.RedirectPort),
+		ReadHeaderTimeout: cfg.ReadTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		Handler:           h,
+	}
+}
+
+// serveRedirect runs the redirect server, failures are logged but don't stop the HTTPS server
+func serveRedirect(srv *http.Server) {
+	log.Infof("redirecting HTTP requests on %s to HTTPS", srv.Addr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Errorf("HTTP redirect server failed: %s", err)
+	}
+}
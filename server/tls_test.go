@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRedirectServer(t *testing.T) {
+	defer func(sc serverConfig) { cfg = sc }(cfg)
+	cfg = defaultConfig()
+	cfg.Port = "8443"
+	cfg.ReadTimeout = 3 * time.Second
+	cfg.WriteTimeout = 4 * time.Second
+	cfg.IdleTimeout = 5 * time.Second
+
+	srv := newRedirectServer(nil)
+	if srv.ReadHeaderTimeout != 3*time.Second || srv.ReadTimeout != 3*time.Second || srv.WriteTimeout != 4*time.Second || srv.IdleTimeout != 5*time.Second {
+		t.Fatalf("redirect server should have the timeouts of the config, got %+v", srv)
+	}
+
+	w := httptest.NewRecorder()
+	srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "http://wallet.example.com/health?x=1", nil))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "https://wallet.example.com:8443/health?x=1" {
+		t.Fatalf("unexpected redirect %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
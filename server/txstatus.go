@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+	log "github.com/sirupsen/logrus"
+	"github.com/skycoin/skycoin/src/api"
+)
+
+// transaction states, see skywallet.TxStatus
+const (
+	txSubmitted = "submitted"
+	txPending   = "pending"
+	txConfirmed = "confirmed"
+	txDropped   = "dropped"
+	txFailed    = "failed"
+	txUnknown   = "unknown"
+)
+
+// trackedTx is a transaction injected through the server, the raw transaction is kept to rebroadcast it
+type trackedTx struct {
+	skywallet.TxStatus
+	rawtx string
+}
+
+// final reports whether the node doesn't need to be asked about the transaction anymore,
+// confirmations of confirmed transactions are counted from the block height
+func (tx *trackedTx) final() bool {
+	return tx.Status == txConfirmed || tx.Status == txFailed
+}
+
+// txTracker follows the transactions injected through the server until they are confirmed,
+// rebroadcasting the ones that fall out of the pool of unconfirmed transactions
+type txTracker struct {
+	interval        time.Duration
+	ttl             time.Duration // how long transactions are tracked
+	maxRebroadcasts int
+	height          func(coinType string) (uint64, bool)
+
+	sync.Mutex
+	txs map[string]*trackedTx // keyed by coin and txid
+}
+
+func newTxTracker(interval, ttl time.Duration, maxRebroadcasts int, height func(coinType string) (uint64, bool)) *txTracker {
+	return &txTracker{
+		interval:        interval,
+		ttl:             ttl,
+		maxRebroadcasts: maxRebroadcasts,
+		height:          height,
+		txs:             make(map[string]*trackedTx),
+	}
+}
+
+func txKey(coinType, txid string) string {
+	return coinType + "/" + txid
+}
+
+// track starts following an injected transaction
+func (tt *txTracker) track(coinType, txid, rawtx string) {
+	tt.Lock()
+	defer tt.Unlock()
+
+	now := time.Now().Unix()
+	tt.txs[txKey(coinType, txid)] = &trackedTx{
+		TxStatus: skywallet.TxStatus{
+			CoinType:    coinType,
+			Txid:        txid,
+			Status:      txSubmitted,
+			Tracked:     true,
+			SubmittedAt: now,
+			UpdatedAt:   now,
+		},
+		rawtx: rawtx,
+	}
+}
+
+// status returns the status of a tracked transaction
+func (tt *txTracker) status(coinType, txid string) (skywallet.TxStatus, bool) {
+	tt.Lock()
+	tx, ok := tt.txs[txKey(coinType, txid)]
+	var st skywallet.TxStatus
+	if ok {
+		st = tx.TxStatus
+	}
+	tt.Unlock()
+
+	if !ok {
+		return st, false
+	}
+
+	if st.Status == txConfirmed {
+		if h, ok := tt.height(coinType); ok && h >= uint64(st.BlockSeq) {
+			st.Confirmations = int64(h-uint64(st.BlockSeq)) + 1
+		}
+	}
+	return st, true
+}
+
+// run re-checks the tracked transactions until quit is closed
+func (tt *txTracker) run(quit chan struct{}) {
+	t := time.NewTicker(tt.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-t.C:
+			tt.expire()
+			tt.checkCoin("")
+		}
+	}
+}
+
+// onNewBlock is a new block handler of the block watcher, pending transactions of the coin may just be confirmed
+func (tt *txTracker) onNewBlock(coinType string, height uint64) {
+	tt.checkCoin(coinType)
+}
+
+// expire stops tracking transactions submitted more than ttl ago
+func (tt *txTracker) expire() {
+	tt.Lock()
+	defer tt.Unlock()
+
+	deadline := time.Now().Add(-tt.ttl).Unix()
+	for k, tx := range tt.txs {
+		if tx.SubmittedAt < deadline {
+			delete(tt.txs, k)
+		}
+	}
+}
+
+// checkCoin checks the transactions of a coin that aren't final, or of all coins when coinType is empty
+func (tt *txTracker) checkCoin(coinType string) {
+	tt.Lock()
+	var txs []trackedTx
+	for _, tx := range tt.txs {
+		if !tx.final() && (coinType == "" || tx.CoinType == coinType) {
+			txs = append(txs, *tx)
+		}
+	}
+	tt.Unlock()
+
+	for _, tx := range txs {
+		tt.check(tx)
+	}
+}
+
+// check asks the node about a transaction and rebroadcasts it when the node doesn't know it
+func (tt *txTracker) check(tx trackedTx) {
+	tr, err := getTransaction(context.Background(), tx.CoinType, tx.Txid)
+	switch {
+	case err == nil && tr.Status.Confirmed:
+		tt.update(tx.CoinType, tx.Txid, func(t *trackedTx) {
+			t.Status = txConfirmed
+			t.Confirmations = int64(tr.Status.Height)
+			t.BlockSeq = int64(tr.Status.BlockSeq)
+			t.Error = ""
+		})
+	case err == nil && tr.Status.Unconfirmed:
+		tt.update(tx.CoinType, tx.Txid, func(t *trackedTx) {
+			t.Status = txPending
+			t.Error = ""
+		})
+	case err == nil || isNotFound(err):
+		// dropped from the pool, i.e, the node restarted or the pool was full
+		tt.rebroadcast(tx)
+	default:
+		log.Warnf("[%s] failed to check transaction %s: %s", tx.CoinType, tx.Txid, err)
+		tt.update(tx.CoinType, tx.Txid, func(t *trackedTx) {
+			t.Error = err.Error()
+		})
+	}
+}
+
+func (tt *txTracker) rebroadcast(tx trackedTx) {
+	if tx.Rebroadcasts >= tt.maxRebroadcasts {
+		log.Warnf("[%s] transaction %s was dropped %d times, giving up", tx.CoinType, tx.Txid, tx.Rebroadcasts)
+		tt.update(tx.CoinType, tx.Txid, func(t *trackedTx) {
+			t.Status = txFailed
+			t.Error = "dropped from the pool of unconfirmed transactions"
+		})
+		return
+	}
+
+	log.Infof("[%s] rebroadcasting transaction %s", tx.CoinType, tx.Txid)
+
+	c := newNodeClient(tx.CoinType)
+	err := observeNodeCall(context.Background(), tx.CoinType, "injectTransaction", func() error {
+		_, err := c.InjectTransaction(tx.rawtx)
+		return err
+	})
+
+	tt.update(tx.CoinType, tx.Txid, func(t *trackedTx) {
+		t.Rebroadcasts++
+		if err != nil {
+			// i.e, its inputs were spent by another transaction meanwhile
+			t.Status = txDropped
+			t.Error = err.Error()
+			return
+		}
+		t.Status = txPending
+		t.Error = ""
+	})
+}
+
+// update applies f to a tracked transaction, unless it stopped being tracked meanwhile
+func (tt *txTracker) update(coinType, txid string, f func(t *trackedTx)) {
+	tt.Lock()
+	defer tt.Unlock()
+
+	if t, ok := tt.txs[txKey(coinType, txid)]; ok {
+		f(t)
+		t.UpdatedAt = time.Now().Unix()
+	}
+}
+
+// isNotFound reports whether a node request failed because the object doesn't exist
+func isNotFound(err error) bool {
+	var ce api.ClientError
+	return errors.As(err, &ce) && ce.StatusCode == http.StatusNotFound
+}
+
+// txStatusHandler returns the status of a transaction, e.g, /skycoin/txStatus?txid=...
+// Transactions not injected through the server are looked up on the node, they are not rebroadcast
+func txStatusHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	coinType := vars["coinType"]
+
+	if !isCoinTypeSupported(coinType) {
+		http.Error(w, fmt.Sprintf("%s is not supported", coinType), http.StatusForbidden)
+		return
+	}
+
+	txid := r.URL.Query().Get("txid")
+	if txid == "" {
+		http.Error(w, "missing txid", http.StatusBadRequest)
+		return
+	}
+
+	st, ok := tracker.status(coinType, txid)
+	if !ok {
+		st = skywallet.TxStatus{
+			CoinType:  coinType,
+			Txid:      txid,
+			Status:    txUnknown,
+			UpdatedAt: time.Now().Unix(),
+		}
+
+		tr, err := getTransaction(r.Context(), coinType, txid)
+		switch {
+		case err == nil && tr.Status.Confirmed:
+			st.Status = txConfirmed
+			st.Confirmations = int64(tr.Status.Height)
+			st.BlockSeq = int64(tr.Status.BlockSeq)
+		case err == nil && tr.Status.Unconfirmed:
+			st.Status = txPending
+		case err == nil || isNotFound(err):
+		default:
+			requestLogger(r).Errorf("failed to get transaction %s: %s", txid, err)
+			http.Error(w, fmt.Sprintf("failed to get transaction information for txid :%s", txid), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	bytes, err := json.MarshalIndent(st, "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal transaction status: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(bytes)
+}
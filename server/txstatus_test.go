@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTxTrackerStatus(t *testing.T) {
+	height := func(coinType string) (uint64, bool) {
+		return 12, coinType == "skycoin"
+	}
+	tt := newTxTracker(time.Minute, time.Hour, 3, height)
+
+	if _, ok := tt.status("skycoin", "tx"); ok {
+		t.Fatal("transaction should not be tracked")
+	}
+
+	tt.track("skycoin", "tx", "raw")
+	st, ok := tt.status("skycoin", "tx")
+	if !ok || st.Status != txSubmitted || !st.Tracked {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	// confirmations follow the block height once the transaction is confirmed
+	tt.update("skycoin", "tx", func(t *trackedTx) {
+		t.Status = txConfirmed
+		t.Confirmations = 1
+		t.BlockSeq = 10
+	})
+	if st, _ := tt.status("skycoin", "tx"); st.Confirmations != 3 {
+		t.Fatalf("expected 3 confirmations, got %d", st.Confirmations)
+	}
+
+	if !tt.txs[txKey("skycoin", "tx")].final() {
+		t.Fatal("confirmed transaction should be final")
+	}
+}
+
+func TestTxTrackerRebroadcastLimit(t *testing.T) {
+	tt := newTxTracker(time.Minute, time.Hour, 2, nil)
+	tt.track("skycoin", "tx", "raw")
+	tt.update("skycoin", "tx", func(t *trackedTx) {
+		t.Rebroadcasts = 2
+	})
+
+	// no node is asked once the limit is reached
+	tt.rebroadcast(*tt.txs[txKey("skycoin", "tx")])
+
+	st, _ := tt.status("skycoin", "tx")
+	if st.Status != txFailed || st.Error == "" {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}
+
+func TestTxTrackerExpire(t *testing.T) {
+	tt := newTxTracker(time.Minute, time.Hour, 2, nil)
+	tt.track("skycoin", "old", "raw")
+	tt.track("skycoin", "new", "raw")
+	tt.txs[txKey("skycoin", "old")].SubmittedAt = time.Now().Add(-2 * time.Hour).Unix()
+
+	tt.expire()
+
+	if _, ok := tt.status("skycoin", "old"); ok {
+		t.Fatal("old transaction should not be tracked anymore")
+	}
+	if _, ok := tt.status("skycoin", "new"); !ok {
+		t.Fatal("new transaction should still be tracked")
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/skycoin/skycoin/src/api"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/coin"
+	"github.com/skycoin/skycoin/src/util/droplet"
+	"github.com/skycoin/skycoin/src/util/fee"
+	"github.com/skycoin/skycoin/src/visor"
+)
+
+// 1 coin is 1e6 droplets
+const dropletDecimals = 6
+
+// rules checked by verifyTransaction, reported to clients in txRuleError
+const (
+	ruleDecode       = "decode"
+	ruleStructure    = "structure"
+	ruleInputExists  = "inputExists"
+	ruleInputUnspent = "inputUnspent"
+	ruleSignature    = "signature"
+	ruleCoinHours    = "coinHours"
+	ruleDust         = "dust"
+)
+
+// txRuleError explains which rule a raw transaction breaks, Input and Output are the index of the
+// offending input or output when the rule is about one of them
+type txRuleError struct {
+	Rule    string `json:"rule"`
+	Message string `json:"error"`
+	Input   *int   `json:"input,omitempty"`
+	Output  *int   `json:"output,omitempty"`
+}
+
+func (e *txRuleError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Rule, e.Message)
+}
+
+func ruleError(rule, format string, args ...interface{}) *txRuleError {
+	return &txRuleError{Rule: rule, Message: fmt.Sprintf(format, args...)}
+}
+
+func inputError(i int, rule, format string, args ...interface{}) *txRuleError {
+	e := ruleError(rule, format, args...)
+	e.Input = &i
+	return e
+}
+
+func outputError(i int, rule, format string, args ...interface{}) *txRuleError {
+	e := ruleError(rule, format, args...)
+	e.Output = &i
+	return e
+}
+
+// uxOut is an output as returned by /api/v1/uxout, spent or not
+type uxOut struct {
+	Uxid          string `json:"uxid"`
+	Time          uint64 `json:"time"`
+	SrcBlockSeq   uint64 `json:"src_block_seq"`
+	SrcTx         string `json:"src_tx"`
+	OwnerAddress  string `json:"owner_address"`
+	Coins         uint64 `json:"coins"` // droplets
+	Hours         uint64 `json:"hours"`
+	SpentBlockSeq uint64 `json:"spent_block_seq"`
+	SpentTxnID    string `json:"spent_tx"`
+}
+
+func (ux uxOut) spent() bool {
+	return ux.SpentTxnID != "" && ux.SpentTxnID != (cipher.SHA256{}).Hex()
+}
+
+func getUxOut(ctx context.Context, c *api.Client, coinType, uxid string) (*uxOut, error) {
+	var ux uxOut
+	err := observeNodeCall(ctx, coinType, "uxout", func() error {
+		return c.Get(fmt.Sprintf("/api/v1/uxout?uxid=%s", uxid), &ux)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ux, nil
+}
+
+// decodeRawTx decodes a hex encoded skycoin transaction
+func decodeRawTx(rawtx string) (coin.Transaction, error) {
+	b, err := hex.DecodeString(rawtx)
+	if err != nil {
+		return coin.Transaction{}, ruleError(ruleDecode, "invalid hex: %v", err)
+	}
+
+	tx, err := coin.TransactionDeserialize(b)
+	if err != nil {
+		return coin.Transaction{}, ruleError(ruleDecode, "invalid transaction: %v", err)
+	}
+	return tx, nil
+}
+
+// verifyTransaction checks a raw transaction the way the node does before it is injected, so that
+// clients get a clear explanation. Errors breaking a rule are *txRuleError, other errors come from the node
+func verifyTransaction(ctx context.Context, coinType, rawtx string) error {
+	tx, err := decodeRawTx(rawtx)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Verify(); err != nil {
+		return ruleError(ruleStructure, "%v", err)
+	}
+
+	cm, _ := coins.get(coinType)
+	if err := verifyOutputs(tx, cm.Decimals, cm.MinSendAmount); err != nil {
+		return err
+	}
+
+	c := newNodeClient(coinType)
+
+	inputs := make(coin.UxArray, len(tx.In))
+	for i, in := range tx.In {
+		ux, err := getUxOut(ctx, c, coinType, in.Hex())
+		switch {
+		case isNotFound(err):
+			return inputError(i, ruleInputExists, "output %s doesn't exist", in.Hex())
+		case err != nil:
+			return err
+		case ux.spent():
+			return inputError(i, ruleInputUnspent, "output %s is already spent by %s", in.Hex(), ux.SpentTxnID)
+		}
+
+		addr, err := cipher.DecodeBase58Address(ux.OwnerAddress)
+		if err != nil {
+			return fmt.Errorf("invalid owner address %s of output %s: %v", ux.OwnerAddress, in.Hex(), err)
+		}
+
+		// inputs are signed with the inner hash of the transaction
+		if err := cipher.ChkSig(addr, cipher.AddSHA256(tx.InnerHash, in), tx.Sigs[i]); err != nil {
+			return inputError(i, ruleSignature, "signature doesn't match owner %s of output %s: %v", ux.OwnerAddress, in.Hex(), err)
+		}
+
+		inputs[i] = coin.UxOut{
+			Head: coin.UxHead{Time: ux.Time, BkSeq: ux.SrcBlockSeq},
+			Body: coin.UxBody{Address: addr, Coins: ux.Coins, Hours: ux.Hours},
+		}
+	}
+
+	if !cm.CoinHours {
+		return nil
+	}
+
+	var bm *visor.BlockchainMetadata
+	err = observeNodeCall(ctx, coinType, "blockchainMetadata", func() error {
+		var err error
+		bm, err = c.BlockchainMetadata()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// input hours are counted at the time of the head block, like the node does
+	f, err := fee.TransactionFee(&tx, bm.Head.Time, inputs)
+	if err != nil {
+		return ruleError(ruleCoinHours, "%v", err)
+	}
+	if err := fee.VerifyTransactionFee(&tx, f); err != nil {
+		return ruleError(ruleCoinHours, "%v, %d coin hours are burned", err, f)
+	}
+
+	return nil
+}
+
+// verifyOutputs checks that outputs don't have more decimals than the coin supports and are
+// at least minSendAmount, decimals 0 means the coin doesn't restrict them
+func verifyOutputs(tx coin.Transaction, decimals int, minSendAmount string) error {
+	var precision uint64 = 1
+	for d := decimals; d > 0 && d < dropletDecimals; d++ {
+		precision *= 10
+	}
+
+	var min uint64
+	if minSendAmount != "" {
+		var err error
+		min, err = droplet.FromString(minSendAmount)
+		if err != nil {
+			return fmt.Errorf("invalid minSendAmount %q: %v", minSendAmount, err)
+		}
+	}
+
+	for i, o := range tx.Out {
+		if o.Coins%precision != 0 {
+			return outputError(i, ruleDust, "%d droplets to %s has more than %d decimals", o.Coins, o.Address, decimals)
+		}
+		if o.Coins < min {
+			return outputError(i, ruleDust, "%d droplets to %s is less than the minimum of %s", o.Coins, o.Address, minSendAmount)
+		}
+	}
+
+	return nil
+}
+
+// writeTxRuleError reports a broken rule as JSON with 422, e.g,
+// {"rule": "inputUnspent", "error": "output ... is already spent by ...", "input": 0}
+func writeTxRuleError(w http.ResponseWriter, e *txRuleError) {
+	bytes, err := json.MarshalIndent(e, "", "    ")
+	if err != nil {
+		http.Error(w, e.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.Write(bytes)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/coin"
+)
+
+func TestVerifyOutputs(t *testing.T) {
+	for _, tc := range []struct {
+		coins         uint64
+		decimals      int
+		minSendAmount string
+		rule          string
+	}{
+		{coins: 1000, decimals: 3},
+		{coins: 1500, decimals: 3, rule: ruleDust},
+		{coins: 1500, decimals: 0},
+		{coins: 1000, decimals: 3, minSendAmount: "0.001"},
+		{coins: 1000, decimals: 3, minSendAmount: "0.01", rule: ruleDust},
+	} {
+		tx := coin.Transaction{Out: []coin.TransactionOutput{{Coins: 1e6}, {Coins: tc.coins}}}
+
+		err := verifyOutputs(tx, tc.decimals, tc.minSendAmount)
+		if tc.rule == "" {
+			if err != nil {
+				t.Errorf("%+v: unexpected error %v", tc, err)
+			}
+			continue
+		}
+
+		e, ok := err.(*txRuleError)
+		if !ok || e.Rule != tc.rule || e.Output == nil || *e.Output != 1 {
+			t.Errorf("%+v: expected %s error of output 1, got %v", tc, tc.rule, err)
+		}
+	}
+}
+
+func TestDecodeRawTx(t *testing.T) {
+	for _, rawtx := range []string{"zz", "00ff"} {
+		_, err := decodeRawTx(rawtx)
+		if e, ok := err.(*txRuleError); !ok || e.Rule != ruleDecode {
+			t.Errorf("%s: expected decode error, got %v", rawtx, err)
+		}
+	}
+}
+
+func TestVerifyTransaction(t *testing.T) {
+	const headTime = 1500000000
+
+	pk, sk := cipher.GenerateKeyPair()
+	owner := cipher.AddressFromPubKey(pk)
+	otherPk, _ := cipher.GenerateKeyPair()
+	other := cipher.AddressFromPubKey(otherPk)
+
+	unspent := cipher.SumSHA256([]byte("unspent"))
+	spent := cipher.SumSHA256([]byte("spent"))
+	missing := cipher.SumSHA256([]byte("missing"))
+	foreign := cipher.SumSHA256([]byte("foreign"))
+
+	// outputs created at the time of the head block, their hours don't grow
+	uxouts := map[string]uxOut{
+		unspent.Hex(): {Uxid: unspent.Hex(), Time: headTime, OwnerAddress: owner.String(), Coins: 2e6, Hours: 100},
+		spent.Hex():   {Uxid: spent.Hex(), Time: headTime, OwnerAddress: owner.String(), Coins: 2e6, Hours: 100, SpentTxnID: cipher.SumSHA256([]byte("tx")).Hex()},
+		foreign.Hex(): {Uxid: foreign.Hex(), Time: headTime, OwnerAddress: other.String(), Coins: 2e6, Hours: 100},
+	}
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/uxout":
+			ux, ok := uxouts[r.URL.Query().Get("uxid")]
+			if !ok {
+				http.Error(w, "404 Not Found", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(ux)
+		case "/api/v1/blockchain/metadata":
+			w.Write([]byte(`{"head": {"seq": 10, "timestamp": 1500000000}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer node.Close()
+	u, _ := url.Parse(node.URL)
+
+	defer func(c *coinRegistry, sc serverConfig) {
+		coins, cfg = c, sc
+	}(coins, cfg)
+	coins = &coinRegistry{list: skywallet.CoinMetas{
+		{NameInEnglish: "skycoin", Symbol: "SKY", WebInterfacePort: u.Port(), Decimals: 3, CoinHours: true},
+	}}
+	cfg = defaultConfig()
+	cfg.NodeServer = "http://127.0.0.1"
+
+	rawtx := func(in cipher.SHA256, coins, hours uint64, f func(tx *coin.Transaction)) string {
+		var tx coin.Transaction
+		tx.PushInput(in)
+		tx.PushOutput(other, coins, hours)
+		tx.SignInputs([]cipher.SecKey{sk})
+		tx.UpdateHeader()
+		if f != nil {
+			f(&tx)
+		}
+		return hex.EncodeToString(tx.Serialize())
+	}
+
+	for _, tc := range []struct {
+		name  string
+		rawtx string
+		rule  string
+	}{
+		{"valid", rawtx(unspent, 2e6, 40, nil), ""},
+		{"not hex", "zz", ruleDecode},
+		{"tampered", rawtx(unspent, 2e6, 40, func(tx *coin.Transaction) { tx.Out[0].Coins = 1e6 }), ruleStructure},
+		{"too many decimals", rawtx(unspent, 1500, 40, nil), ruleDust},
+		{"missing input", rawtx(missing, 2e6, 40, nil), ruleInputExists},
+		{"spent input", rawtx(spent, 2e6, 40, nil), ruleInputUnspent},
+		{"other owner", rawtx(foreign, 2e6, 40, nil), ruleSignature},
+		{"no fee", rawtx(unspent, 2e6, 100, nil), ruleCoinHours},
+		{"too many hours", rawtx(unspent, 2e6, 200, nil), ruleCoinHours},
+	} {
+		err := verifyTransaction(context.Background(), "skycoin", tc.rawtx)
+		if tc.rule == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tc.name, err)
+			}
+			continue
+		}
+
+		if e, ok := err.(*txRuleError); !ok || e.Rule != tc.rule {
+			t.Errorf("%s: expected %s error, got %v", tc.name, tc.rule, err)
+		}
+	}
+}
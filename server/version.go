@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// clientVersionHeader carries the API version of the mobile package, see mobile.GetApiVersion
+const clientVersionHeader = "X-Superwallet-Api-Version"
+
+// nodeIncompatibleHeader flags responses served by a node whose version doesn't match CoinMeta.NodeVersion
+const nodeIncompatibleHeader = "X-Superwallet-Node-Incompatible"
+
+// coinListVersion is the first client API version getting getSupportedCoins as an ordered list
+var coinListVersion = semver.MustParse("1.1.0")
+
+type clientVersionKey struct{}
+
+// nodeVersionCompatible checks a node version against the configured nodeVersion, which can be
+// an exact version such as "0.24.1" or a semver range such as ">=0.24.0 <0.25.0"
+func nodeVersionCompatible(expected, actual string) (bool, error) {
+	if expected == "" {
+		return true, nil
+	}
+
+	r, err := semver.ParseRange(expected)
+	if err != nil {
+		return false, fmt.Errorf("invalid node version range %q: %v", expected, err)
+	}
+
+	v, err := semver.ParseTolerant(actual)
+	if err != nil {
+		return false, fmt.Errorf("invalid node version %q: %v", actual, err)
+	}
+
+	return r(v), nil
+}
+
+// nodeCompatibilityMiddleware refuses or flags requests for coins whose node is known to be incompatible
+func nodeCompatibilityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		coinType := mux.Vars(r)["coinType"]
+		if !isCoinTypeSupported(coinType) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// legacy clients don't know about degraded and incompatible coins, they still list them
+		// so that the wallets of their users don't disappear, but their requests are refused
+		if _, versioned := clientVersion(r); !versioned {
+			if err := checkLegacyAvailable(coinType); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		if incompatible, err := checkNodeCompatible(coinType); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		} else if incompatible {
+			w.Header().Set(nodeIncompatibleHeader, "true")
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkNodeCompatible reports whether the node of a coin is known to be incompatible, with an
+// error when requests for the coin must be refused because of it, see RefuseIncompatibleNodes
+func checkNodeCompatible(coinType string) (bool, error) {
+	st, ok := watcher.status(coinType)
+	if !ok || st.NodeVersion == "" || st.VersionCompatible {
+		return false, nil
+	}
+
+	if cfg.RefuseIncompatibleNodes {
+		return true, fmt.Errorf("[%s] node version %s is not compatible with %s", coinType, st.NodeVersion, st.ExpectedVersion)
+	}
+	return true, nil
+}
+
+// checkLegacyAvailable returns an error when the node of a coin is known to be unreachable or
+// incompatible, legacy clients can't tell from the coin list or the nodeIncompatibleHeader
+func checkLegacyAvailable(coinType string) error {
+	st, ok := watcher.status(coinType)
+	if !ok {
+		return nil
+	}
+
+	if !st.Reachable {
+		return fmt.Errorf("[%s] node is unreachable, please try again later", coinType)
+	}
+	if st.NodeVersion != "" && !st.VersionCompatible {
+		return fmt.Errorf("[%s] node version %s is not compatible with %s", coinType, st.NodeVersion, st.ExpectedVersion)
+	}
+	return nil
+}
+
+// clientVersionMiddleware rejects outdated mobile clients and stores the client API version
+// in the request context so that handlers can adapt responses for older builds
+func clientVersionMiddleware(next http.Handler) http.Handler {
+	var min *semver.Version
+	if cfg.MinClientVersion != "" {
+		v, err := semver.ParseTolerant(cfg.MinClientVersion)
+		if err != nil {
+			log.Fatalf("invalid min client version %s: %s", cfg.MinClientVersion, err)
+		}
+		min = &v
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// load balancers, monitoring and operations staff are not mobile clients
+		if r.URL.Path == "/health" || r.URL.Path == "/ready" || r.URL.Path == "/metrics" || strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get(clientVersionHeader)
+		if header == "" {
+			if cfg.RejectLegacyClients {
+				http.Error(w, fmt.Sprintf("missing %s header, please upgrade the app", clientVersionHeader), http.StatusUpgradeRequired)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		v, err := semver.ParseTolerant(header)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid client version %s", header), http.StatusBadRequest)
+			return
+		}
+
+		if min != nil && v.LT(*min) {
+			http.Error(w, fmt.Sprintf("client version %s is no longer supported, %s or later is required", v, min), http.StatusUpgradeRequired)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientVersionKey{}, v)))
+	})
+}
+
+// clientImplements tells whether the client sent an API version of at least v
+func clientImplements(r *http.Request, v semver.Version) bool {
+	cv, ok := clientVersion(r)
+	return ok && cv.GTE(v)
+}
+
+// clientVersion returns the API version sent by the client, false for legacy clients that don't send it
+func clientVersion(r *http.Request) (semver.Version, bool) {
+	v, ok := r.Context().Value(clientVersionKey{}).(semver.Version)
+	return v, ok
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/gorilla/mux"
+
+	skywallet "github.com/hankgao/superwallet-server/server/mobile"
+)
+
+func TestNodeVersionCompatible(t *testing.T) {
+	cases := []struct {
+		expected string
+		actual   string
+		ok       bool
+	}{
+		{"0.24.1", "0.24.1", true},
+		{"0.24.1", "v0.24.1", true},
+		{"0.24.1", "0.24.0", false},
+		{">=0.24.0 <0.25.0", "0.24.1", true},
+		{">=0.24.0 <0.25.0", "0.25.0", false},
+		{"", "0.1.0", true},
+	}
+
+	for _, c := range cases {
+		ok, err := nodeVersionCompatible(c.expected, c.actual)
+		if err != nil {
+			t.Errorf("%q vs %q: %v", c.expected, c.actual, err)
+			continue
+		}
+		if ok != c.ok {
+			t.Errorf("%q vs %q: expected %v, got %v", c.expected, c.actual, c.ok, ok)
+		}
+	}
+}
+
+func TestNodeCompatibilityMiddlewareLegacyClients(t *testing.T) {
+	defer func(c *coinRegistry, sc serverConfig, bw *blockWatcher) {
+		coins, cfg, watcher = c, sc, bw
+	}(coins, cfg, watcher)
+	coins = &coinRegistry{list: skywallet.CoinMetas{
+		{NameInEnglish: "skycoin", Symbol: "SKY"},
+		{NameInEnglish: "mzcoin", Symbol: "MZC"},
+		{NameInEnglish: "shellcoin", Symbol: "SC2"},
+	}}
+	cfg = defaultConfig()
+	watcher = newBlockWatcher(time.Minute)
+	watcher.nodeStatuses["skycoin"] = nodeStatus{Reachable: true, NodeVersion: "0.24.1", VersionCompatible: true}
+	watcher.nodeStatuses["mzcoin"] = nodeStatus{Reachable: false}
+	watcher.nodeStatuses["shellcoin"] = nodeStatus{Reachable: true, NodeVersion: "0.23.0", ExpectedVersion: "0.24.1"}
+
+	h := nodeCompatibilityMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		coinType  string
+		versioned bool
+		status    int
+	}{
+		{"skycoin", false, http.StatusOK},
+		{"mzcoin", false, http.StatusServiceUnavailable},
+		{"mzcoin", true, http.StatusOK},
+		{"shellcoin", false, http.StatusServiceUnavailable},
+		{"shellcoin", true, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/getBalance/"+c.coinType, nil)
+		r = mux.SetURLVars(r, map[string]string{"coinType": c.coinType})
+		if c.versioned {
+			r = r.WithContext(context.WithValue(r.Context(), clientVersionKey{}, semver.MustParse("1.1.0")))
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.status {
+			t.Errorf("%s (versioned %v): expected status %d, got %d", c.coinType, c.versioned, c.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// blockWatcher polls the node of each supported coin, keeps its status and notifies handlers
+// when a new block shows up or when the node goes down, comes back or changes version compatibility
+type blockWatcher struct {
+	interval time.Duration
+
+	sync.RWMutex
+	heights        map[string]uint64
+	firstHeights   map[string]uint64 // height of a coin when its node was first reached
+	nodeStatuses   map[string]nodeStatus
+	handlers       []func(coinType string, height uint64)
+	statusHandlers []func(coinType string, st nodeStatus)
+}
+
+func newBlockWatcher(interval time.Duration) *blockWatcher {
+	return &blockWatcher{
+		interval:     interval,
+		heights:      make(map[string]uint64),
+		firstHeights: make(map[string]uint64),
+		nodeStatuses: make(map[string]nodeStatus),
+	}
+}
+
+// onNewBlock registers a handler, handlers must be registered before run is called
+func (bw *blockWatcher) onNewBlock(f func(coinType string, height uint64)) {
+	bw.Lock()
+	defer bw.Unlock()
+
+	bw.handlers = append(bw.handlers, f)
+}
+
+// onStatusChange registers a handler called when a node becomes reachable or unreachable, or
+// compatible or incompatible, handlers must be registered before run is called
+func (bw *blockWatcher) onStatusChange(f func(coinType string, st nodeStatus)) {
+	bw.Lock()
+	defer bw.Unlock()
+
+	bw.statusHandlers = append(bw.statusHandlers, f)
+}
+
+// status returns the last known node status of a coin
+func (bw *blockWatcher) status(coinType string) (nodeStatus, bool) {
+	bw.RLock()
+	defer bw.RUnlock()
+
+	st, ok := bw.nodeStatuses[coinType]
+	return st, ok
+}
+
+// statuses returns a copy of the last known node status of all coins
+func (bw *blockWatcher) statuses() map[string]nodeStatus {
+	bw.RLock()
+	defer bw.RUnlock()
+
+	ret := make(map[string]nodeStatus, len(bw.nodeStatuses))
+	for k, v := range bw.nodeStatuses {
+		ret[k] = v
+	}
+	return ret
+}
+
+// height returns the last block height seen for a coin
+func (bw *blockWatcher) height(coinType string) (uint64, bool) {
+	bw.RLock()
+	defer bw.RUnlock()
+
+	h, ok := bw.heights[coinType]
+	return h, ok
+}
+
+// firstHeight returns the block height seen when the node of a coin was first reached, handlers
+// are only called for the blocks after it
+func (bw *blockWatcher) firstHeight(coinType string) (uint64, bool) {
+	bw.RLock()
+	defer bw.RUnlock()
+
+	h, ok := bw.firstHeights[coinType]
+	return h, ok
+}
+
+// forget drops what is known about a coin, i.e, when it is disabled, removed or its node changed
+func (bw *blockWatcher) forget(coinType string) {
+	bw.Lock()
+	defer bw.Unlock()
+
+	delete(bw.heights, coinType)
+	delete(bw.firstHeights, coinType)
+	delete(bw.nodeStatuses, coinType)
+}
+
+// run polls the nodes until quit is closed
+func (bw *blockWatcher) run(quit chan struct{}) {
+	bw.poll()
+
+	t := time.NewTicker(bw.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-t.C:
+			bw.poll()
+		}
+	}
+}
+
+func (bw *blockWatcher) poll() {
+	var wg sync.WaitGroup
+	for coinType := range coins.enabled() {
+		wg.Add(1)
+		go func(coinType string) {
+			defer wg.Done()
+			bw.pollCoin(coinType)
+		}(coinType)
+	}
+	wg.Wait()
+}
+
+func (bw *blockWatcher) pollCoin(coinType string) {
+	st := checkNode(coinType)
+
+	bw.Lock()
+	prev, checked := bw.nodeStatuses[coinType]
+	bw.nodeStatuses[coinType] = st
+	statusHandlers := bw.statusHandlers
+	bw.Unlock()
+
+	if !checked || prev.Reachable != st.Reachable || prev.VersionCompatible != st.VersionCompatible {
+		if !st.Reachable {
+			log.Warnf("[%s] node is unreachable: %s", coinType, st.Error)
+		}
+		for _, f := range statusHandlers {
+			f(coinType, st)
+		}
+	}
+
+	if !st.Reachable {
+		return
+	}
+
+	height := st.BlockHeight
+
+	bw.Lock()
+	last, seen := bw.heights[coinType]
+	bw.heights[coinType] = height
+	if !seen {
+		bw.firstHeights[coinType] = height
+	}
+	handlers := bw.handlers
+	bw.Unlock()
+
+	recordBlockHeight(coinType, height, !seen || last != height)
+
+	if !seen || last == height {
+		return
+	}
+
+	log.Infof("[%s] new block %d", coinType, height)
+	for _, f := range handlers {
+		f(coinType, height)
+	}
+}
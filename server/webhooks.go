@@ -0,0 +1,678 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+const (
+	webhookSignatureHeader = "X-Superwallet-Signature"
+	webhookDeliveryHeader  = "X-Superwallet-Delivery"
+
+	// delivered deliveries kept for inspection
+	webhookHistorySize = 1000
+
+	// dead deliveries kept until they are replayed, the oldest are dropped over it
+	webhookDeadLetterSize = 1000
+
+	// deliveries posted at once to a webhook, a slow endpoint only delays its own deliveries
+	webhookDeliveryConcurrency = 4
+
+	webhookMaxRetryDelay = 6 * time.Hour
+
+	// payments wait in memory and in the webhooks file until they are confirmed enough
+	webhookMaxConfirmations = 1000
+)
+
+// delivery states
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryDead      = "dead"
+)
+
+var (
+	errWebhookNotFound  = errors.New("webhook not found")
+	errDeliveryNotFound = errors.New("delivery not found")
+)
+
+// webhook is registered by a merchant to be called when its addresses receive coins
+type webhook struct {
+	ID               string    `json:"id"`
+	URL              string    `json:"url"`
+	CoinType         string    `json:"coinType"`
+	Addrs            []string  `json:"addrs"`
+	MinConfirmations uint64    `json:"minConfirmations"`
+	Secret           string    `json:"secret,omitempty"` // only returned when the webhook is registered
+	CreatedAt        time.Time `json:"createdAt"`
+}
+
+// webhookPayload is the body posted to webhooks, signed with HMAC-SHA256 of the webhook secret
+// in the X-Superwallet-Signature header, i.e, sha256=<hex>
+type webhookPayload struct {
+	DeliveryID    string  `json:"deliveryId"`
+	WebhookID     string  `json:"webhookId"`
+	Event         string  `json:"event"`
+	Confirmations uint64  `json:"confirmations"`
+	Payment       payment `json:"payment"`
+}
+
+// delivery is a payload and the attempts to post it
+type delivery struct {
+	ID          string         `json:"id"`
+	WebhookID   string         `json:"webhookId"`
+	State       string         `json:"state"`
+	Attempts    int            `json:"attempts"`
+	NextAttempt time.Time      `json:"nextAttempt,omitempty"`
+	LastStatus  int            `json:"lastStatus,omitempty"`
+	LastError   string         `json:"lastError,omitempty"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+	Payload     webhookPayload `json:"payload"`
+}
+
+// waitingPayment is a payment to a webhook address that doesn't have enough confirmations yet
+type waitingPayment struct {
+	WebhookID string  `json:"webhookId"`
+	Payment   payment `json:"payment"`
+}
+
+// webhookState is what is saved to the webhooks file
+type webhookState struct {
+	Webhooks   []*webhook        `json:"webhooks"`
+	Waiting    []*waitingPayment `json:"waiting"`
+	Deliveries []*delivery       `json:"deliveries"`
+}
+
+// webhookService turns payments reported by the payment scanner into deliveries once they have
+// the confirmations a webhook asks for, and posts them in the background with exponential backoff.
+// Deliveries that fail maxAttempts times are dead until they are replayed
+type webhookService struct {
+	file        string
+	maxAttempts int
+	retryDelay  time.Duration
+	client      *http.Client
+	wake        chan struct{}
+
+	// posting goroutines, see deliverDue
+	inflight sync.WaitGroup
+
+	sync.Mutex
+	hooks      map[string]*webhook
+	index      map[string]map[string][]string // coin, address, webhook IDs
+	waiting    []*waitingPayment
+	deliveries []*delivery     // oldest first
+	posting    map[string]bool // webhooks whose due deliveries are being posted
+}
+
+func newWebhookService(file string, maxAttempts int, retryDelay time.Duration) (*webhookService, error) {
+	ws := &webhookService{
+		file:        file,
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		wake:        make(chan struct{}, 1),
+		hooks:       make(map[string]*webhook),
+		posting:     make(map[string]bool),
+	}
+
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, fmt.Errorf("failed to read webhooks file: %v", err)
+		default:
+			var st webhookState
+			if err := json.Unmarshal(b, &st); err != nil {
+				return nil, fmt.Errorf("failed to parse webhooks file %s: %v", file, err)
+			}
+			for _, wh := range st.Webhooks {
+				ws.hooks[wh.ID] = wh
+			}
+			ws.waiting = st.Waiting
+			ws.deliveries = st.Deliveries
+		}
+	}
+
+	ws.reindex()
+
+	return ws, nil
+}
+
+// reindex rebuilds the address index, the caller holds the lock
+func (ws *webhookService) reindex() {
+	ws.index = make(map[string]map[string][]string)
+	for id, wh := range ws.hooks {
+		if ws.index[wh.CoinType] == nil {
+			ws.index[wh.CoinType] = make(map[string][]string)
+		}
+		for _, a := range wh.Addrs {
+			ws.index[wh.CoinType][a] = append(ws.index[wh.CoinType][a], id)
+		}
+	}
+}
+
+// save writes the webhooks and deliveries to file, the caller holds the lock
+func (ws *webhookService) save() error {
+	if ws.file == "" {
+		return nil
+	}
+
+	st := webhookState{
+		Webhooks:   ws.list(true),
+		Waiting:    ws.waiting,
+		Deliveries: ws.deliveries,
+	}
+
+	b, err := json.MarshalIndent(st, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(ws.file, b, 0600)
+}
+
+// saveOrLog is used where there is no caller to report errors to, the caller holds the lock
+func (ws *webhookService) saveOrLog() {
+	if err := ws.save(); err != nil {
+		log.Errorf("failed to save webhooks: %s", err)
+	}
+}
+
+func newWebhookID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// add registers a webhook, a secret is generated when it has none
+func (ws *webhookService) add(wh webhook) (webhook, error) {
+	wh.ID = newWebhookID()
+	wh.CreatedAt = time.Now().UTC()
+	if wh.Secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return webhook{}, err
+		}
+		wh.Secret = hex.EncodeToString(b)
+	}
+
+	ws.Lock()
+	defer ws.Unlock()
+
+	ws.hooks[wh.ID] = &wh
+	ws.reindex()
+
+	return wh, ws.save()
+}
+
+// remove unregisters a webhook, its waiting payments and pending deliveries are dropped
+func (ws *webhookService) remove(id string) error {
+	ws.Lock()
+	defer ws.Unlock()
+
+	if _, ok := ws.hooks[id]; !ok {
+		return errWebhookNotFound
+	}
+	delete(ws.hooks, id)
+	ws.reindex()
+
+	waiting := ws.waiting[:0]
+	for _, wp := range ws.waiting {
+		if wp.WebhookID != id {
+			waiting = append(waiting, wp)
+		}
+	}
+	ws.waiting = waiting
+
+	deliveries := ws.deliveries[:0]
+	for _, d := range ws.deliveries {
+		if d.WebhookID != id || d.State != deliveryPending {
+			deliveries = append(deliveries, d)
+		}
+	}
+	ws.deliveries = deliveries
+
+	return ws.save()
+}
+
+// list returns the webhooks sorted by creation, the caller holds the lock
+func (ws *webhookService) list(withSecrets bool) []*webhook {
+	ret := make([]*webhook, 0, len(ws.hooks))
+	for _, wh := range ws.hooks {
+		c := *wh
+		if !withSecrets {
+			c.Secret = ""
+		}
+		ret = append(ret, &c)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].CreatedAt.Before(ret[j].CreatedAt)
+	})
+	return ret
+}
+
+// handlePayment is a payment handler of the payment scanner, payments wait for onNewBlock
+// to count their confirmations, which happens right after the block is scanned
+func (ws *webhookService) handlePayment(p payment) {
+	ws.Lock()
+	defer ws.Unlock()
+
+	ids := ws.index[p.CoinType][p.Address]
+	if len(ids) == 0 {
+		return
+	}
+
+	for _, id := range ids {
+		ws.waiting = append(ws.waiting, &waitingPayment{WebhookID: id, Payment: p})
+	}
+
+	ws.saveOrLog()
+}
+
+// onNewBlock is a new block handler of the block watcher, it delivers waiting payments
+// that got enough confirmations
+func (ws *webhookService) onNewBlock(coinType string, height uint64) {
+	ws.Lock()
+	defer ws.Unlock()
+
+	changed := false
+	waiting := ws.waiting[:0]
+	for _, wp := range ws.waiting {
+		wh, ok := ws.hooks[wp.WebhookID]
+		if !ok {
+			changed = true
+			continue
+		}
+
+		if wp.Payment.CoinType == coinType && height >= wp.Payment.BlockSeq {
+			// a payment in the last block has one confirmation
+			if confirmations := height - wp.Payment.BlockSeq + 1; confirmations >= wh.MinConfirmations {
+				ws.enqueue(wh.ID, wp.Payment, confirmations)
+				changed = true
+				continue
+			}
+		}
+		waiting = append(waiting, wp)
+	}
+	ws.waiting = waiting
+
+	if changed {
+		ws.saveOrLog()
+	}
+}
+
+// enqueue creates a pending delivery, the caller holds the lock
+func (ws *webhookService) enqueue(webhookID string, p payment, confirmations uint64) {
+	now := time.Now().UTC()
+	d := &delivery{
+		ID:          newWebhookID(),
+		WebhookID:   webhookID,
+		State:       deliveryPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	d.Payload = webhookPayload{
+		DeliveryID:    d.ID,
+		WebhookID:     webhookID,
+		Event:         "payment",
+		Confirmations: confirmations,
+		Payment:       p,
+	}
+	ws.deliveries = append(ws.deliveries, d)
+	ws.prune()
+
+	select {
+	case ws.wake <- struct{}{}:
+	default:
+	}
+}
+
+// prune drops the oldest delivered deliveries over webhookHistorySize and the oldest dead ones
+// over webhookDeadLetterSize, the caller holds the lock
+func (ws *webhookService) prune() {
+	delivered, dead := 0, 0
+	for _, d := range ws.deliveries {
+		switch d.State {
+		case deliveryDelivered:
+			delivered++
+		case deliveryDead:
+			dead++
+		}
+	}
+
+	if delivered <= webhookHistorySize && dead <= webhookDeadLetterSize {
+		return
+	}
+
+	deliveries := ws.deliveries[:0]
+	for _, d := range ws.deliveries {
+		if d.State == deliveryDelivered && delivered > webhookHistorySize {
+			delivered--
+			continue
+		}
+		if d.State == deliveryDead && dead > webhookDeadLetterSize {
+			log.Warnf("[%s] dropping dead delivery %s to webhook %s, the dead-letter list is full", d.Payload.Payment.CoinType, d.ID, d.WebhookID)
+			dead--
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	ws.deliveries = deliveries
+}
+
+// run posts due deliveries until quit is closed
+func (ws *webhookService) run(quit chan struct{}) {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-quit:
+			ws.inflight.Wait()
+			return
+		case <-t.C:
+		case <-ws.wake:
+		}
+
+		ws.deliverDue()
+	}
+}
+
+// deliverDue starts posting the pending deliveries whose next attempt is due, in the background.
+// Each webhook gets its own goroutine, so that an endpoint that is down doesn't delay the others,
+// webhooks whose previous deliveries are still being posted are skipped until they are done
+func (ws *webhookService) deliverDue() {
+	now := time.Now()
+
+	ws.Lock()
+	defer ws.Unlock()
+
+	todo := make(map[string][]delivery)
+	for _, d := range ws.deliveries {
+		if d.State != deliveryPending || d.NextAttempt.After(now) || ws.posting[d.WebhookID] {
+			continue
+		}
+		if _, ok := ws.hooks[d.WebhookID]; ok {
+			todo[d.WebhookID] = append(todo[d.WebhookID], *d)
+		}
+	}
+
+	for id, ds := range todo {
+		ws.posting[id] = true
+		ws.inflight.Add(1)
+		go ws.deliver(*ws.hooks[id], ds)
+	}
+}
+
+// deliver posts deliveries to a webhook, webhookDeliveryConcurrency at a time, the webhooks file
+// is saved once they have all been attempted
+func (ws *webhookService) deliver(wh webhook, ds []delivery) {
+	defer ws.inflight.Done()
+
+	sem := make(chan struct{}, webhookDeliveryConcurrency)
+	var wg sync.WaitGroup
+	for _, d := range ds {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(d delivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			status, err := ws.post(wh, d.Payload)
+			ws.recordAttempt(d.ID, status, err)
+		}(d)
+	}
+	wg.Wait()
+
+	ws.Lock()
+	defer ws.Unlock()
+
+	delete(ws.posting, wh.ID)
+	ws.saveOrLog()
+}
+
+// post sends a payload to a webhook, non 2xx statuses are errors
+func (ws *webhookService) post(wh webhook, p webhookPayload) (int, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest("POST", wh.URL, bytes.NewReader(b))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookDeliveryHeader, p.DeliveryID)
+	req.Header.Set(webhookSignatureHeader, "sha256="+signPayload(wh.Secret, b))
+
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signPayload returns the hex encoded HMAC-SHA256 of body
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryDelayAfter returns how long to wait after the given number of failed attempts,
+// the delay doubles with each attempt up to webhookMaxRetryDelay
+func (ws *webhookService) retryDelayAfter(attempts int) time.Duration {
+	d := ws.retryDelay
+	for i := 1; i < attempts && d < webhookMaxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > webhookMaxRetryDelay {
+		d = webhookMaxRetryDelay
+	}
+	return d
+}
+
+// recordAttempt updates a delivery after an attempt, it is saved by the caller
+func (ws *webhookService) recordAttempt(id string, status int, err error) {
+	ws.Lock()
+	defer ws.Unlock()
+
+	d := ws.find(id)
+	// removed or replayed meanwhile
+	if d == nil || d.State != deliveryPending {
+		return
+	}
+
+	now := time.Now().UTC()
+	d.Attempts++
+	d.LastStatus = status
+	d.UpdatedAt = now
+
+	switch {
+	case err == nil:
+		d.State = deliveryDelivered
+		d.LastError = ""
+		d.NextAttempt = time.Time{}
+		ws.prune()
+	case d.Attempts >= ws.maxAttempts:
+		log.Warnf("[%s] delivery %s to webhook %s failed %d times, giving up: %s", d.Payload.Payment.CoinType, d.ID, d.WebhookID, d.Attempts, err)
+		d.State = deliveryDead
+		d.LastError = err.Error()
+		d.NextAttempt = time.Time{}
+		ws.prune()
+	default:
+		d.LastError = err.Error()
+		d.NextAttempt = now.Add(ws.retryDelayAfter(d.Attempts))
+	}
+}
+
+// find returns a delivery by ID, the caller holds the lock
+func (ws *webhookService) find(id string) *delivery {
+	for _, d := range ws.deliveries {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
+// deliveriesOf returns the deliveries of a webhook, or of all webhooks when webhookID is empty,
+// in the given state or in any state when state is empty, newest first
+func (ws *webhookService) deliveriesOf(webhookID, state string) []delivery {
+	ws.Lock()
+	defer ws.Unlock()
+
+	ret := []delivery{}
+	for i := len(ws.deliveries) - 1; i >= 0; i-- {
+		d := ws.deliveries[i]
+		if (webhookID == "" || d.WebhookID == webhookID) && (state == "" || d.State == state) {
+			ret = append(ret, *d)
+		}
+	}
+	return ret
+}
+
+// replay makes a delivery pending again with a fresh set of attempts, i.e, a dead one once
+// the merchant fixed its endpoint
+func (ws *webhookService) replay(id string) (delivery, error) {
+	ws.Lock()
+	defer ws.Unlock()
+
+	d := ws.find(id)
+	if d == nil {
+		return delivery{}, errDeliveryNotFound
+	}
+	if _, ok := ws.hooks[d.WebhookID]; !ok {
+		return delivery{}, errWebhookNotFound
+	}
+
+	now := time.Now().UTC()
+	d.State = deliveryPending
+	d.Attempts = 0
+	d.NextAttempt = now
+	d.UpdatedAt = now
+
+	select {
+	case ws.wake <- struct{}{}:
+	default:
+	}
+
+	return *d, ws.save()
+}
+
+func validateWebhook(wh webhook) error {
+	u, err := url.Parse(wh.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", wh.URL)
+	}
+
+	if !isCoinTypeSupported(wh.CoinType) {
+		return fmt.Errorf("%s is not supported", wh.CoinType)
+	}
+
+	if wh.MinConfirmations > webhookMaxConfirmations {
+		return fmt.Errorf("minConfirmations must be at most %d", webhookMaxConfirmations)
+	}
+
+	if len(wh.Addrs) == 0 {
+		return errors.New("missing addrs")
+	}
+
+	if cfg.MaxAddrs > 0 && len(wh.Addrs) > cfg.MaxAddrs {
+		return fmt.Errorf("too many addresses: %d, at most %d are allowed", len(wh.Addrs), cfg.MaxAddrs)
+	}
+
+	for _, a := range wh.Addrs {
+		if _, err := cipher.DecodeBase58Address(a); err != nil {
+			return fmt.Errorf("invalid address %s: %v", a, err)
+		}
+	}
+
+	return nil
+}
+
+func adminListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks.Lock()
+	hooks := webhooks.list(false)
+	webhooks.Unlock()
+
+	writeAdminResult(w, r, hooks, nil)
+}
+
+// adminAddWebhookHandler registers a webhook, the body being
+// {"url": "https://...", "coinType": "skycoin", "addrs": ["..."], "minConfirmations": 3, "secret": "..."},
+// the secret is generated when missing and is only part of this response
+func adminAddWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %s", err), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var wh webhook
+	if err := json.Unmarshal(b, &wh); err != nil {
+		http.Error(w, fmt.Sprintf("invalid webhook: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateWebhook(wh); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wh, err = webhooks.add(wh)
+	writeAdminResult(w, r, wh, err)
+}
+
+func adminRemoveWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	writeAdminResult(w, r, struct{}{}, webhooks.remove(id))
+}
+
+// adminDeliveriesHandler lists deliveries, newest first, e.g,
+// /admin/deliveries?state=dead is the dead-letter list and ?webhook=<id> the deliveries of a webhook
+func adminDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	state := q.Get("state")
+	switch state {
+	case "", deliveryPending, deliveryDelivered, deliveryDead:
+	default:
+		http.Error(w, fmt.Sprintf("invalid state %q", state), http.StatusBadRequest)
+		return
+	}
+
+	writeAdminResult(w, r, webhooks.deliveriesOf(q.Get("webhook"), state), nil)
+}
+
+func adminReplayDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	d, err := webhooks.replay(mux.Vars(r)["id"])
+	writeAdminResult(w, r, d, err)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWebhookConfirmations(t *testing.T) {
+	ws, err := newWebhookService("", 3, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wh, err := ws.add(webhook{URL: "http://127.0.0.1", CoinType: "skycoin", Addrs: []string{"a"}, MinConfirmations: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wh.Secret == "" {
+		t.Fatal("secret should be generated")
+	}
+
+	ws.handlePayment(payment{CoinType: "skycoin", Address: "a", Txid: "tx", Coins: "1.000000", BlockSeq: 10})
+	ws.handlePayment(payment{CoinType: "skycoin", Address: "b", Txid: "tx", Coins: "1.000000", BlockSeq: 10})
+	ws.onNewBlock("skycoin", 10)
+	ws.onNewBlock("skycoin", 11)
+	if len(ws.deliveriesOf("", "")) != 0 {
+		t.Fatal("payment doesn't have enough confirmations yet")
+	}
+
+	ws.onNewBlock("mzcoin", 12)
+	ws.onNewBlock("skycoin", 12)
+	ds := ws.deliveriesOf(wh.ID, deliveryPending)
+	if len(ds) != 1 || ds[0].Payload.Confirmations != 3 || ds[0].Payload.Payment.Txid != "tx" {
+		t.Fatalf("unexpected deliveries %+v", ds)
+	}
+	if len(ws.waiting) != 0 {
+		t.Fatalf("payment should not be waiting anymore")
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	var fail bool
+	var got []*http.Request
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		got = append(got, r)
+		bodies = append(bodies, b)
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "superwallet-webhooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "webhooks.json")
+
+	ws, err := newWebhookService(file, 2, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wh, err := ws.add(webhook{URL: srv.URL, CoinType: "skycoin", Addrs: []string{"a"}, Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws.handlePayment(payment{CoinType: "skycoin", Address: "a", Txid: "tx1", Coins: "1.000000", BlockSeq: 5})
+	ws.onNewBlock("skycoin", 5)
+	ws.deliverDue()
+	ws.inflight.Wait()
+
+	if len(got) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(got))
+	}
+	if sig := got[0].Header.Get(webhookSignatureHeader); sig != "sha256="+signPayload("s3cret", bodies[0]) {
+		t.Fatalf("invalid signature %s", sig)
+	}
+	var p webhookPayload
+	if err := json.Unmarshal(bodies[0], &p); err != nil || p.WebhookID != wh.ID || p.Confirmations != 1 {
+		t.Fatalf("unexpected payload %s", bodies[0])
+	}
+	if ds := ws.deliveriesOf("", deliveryDelivered); len(ds) != 1 {
+		t.Fatalf("expected 1 delivered delivery, got %+v", ds)
+	}
+
+	// failed deliveries are retried, then dead
+	fail = true
+	ws.handlePayment(payment{CoinType: "skycoin", Address: "a", Txid: "tx2", Coins: "1.000000", BlockSeq: 6})
+	ws.onNewBlock("skycoin", 6)
+	for i := 0; i < 2; i++ {
+		time.Sleep(5 * time.Millisecond)
+		ws.deliverDue()
+		ws.inflight.Wait()
+	}
+
+	dead := ws.deliveriesOf("", deliveryDead)
+	if len(dead) != 1 || dead[0].Attempts != 2 || dead[0].LastStatus != http.StatusInternalServerError {
+		t.Fatalf("unexpected dead deliveries %+v", dead)
+	}
+
+	// the dead-letter list survives a restart
+	reloaded, err := newWebhookService(file, 2, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.deliveriesOf("", deliveryDead)) != 1 {
+		t.Fatal("dead delivery should be reloaded")
+	}
+
+	fail = false
+	if _, err := ws.replay(dead[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	ws.deliverDue()
+	ws.inflight.Wait()
+	if ds := ws.deliveriesOf("", deliveryDelivered); len(ds) != 2 {
+		t.Fatalf("replayed delivery should be delivered, got %+v", ds)
+	}
+
+	if _, err := ws.replay("unknown"); err != errDeliveryNotFound {
+		t.Fatalf("expected errDeliveryNotFound, got %v", err)
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	ws := &webhookService{retryDelay: time.Minute}
+
+	for attempts, expected := range map[int]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		4:  8 * time.Minute,
+		50: webhookMaxRetryDelay,
+	} {
+		if d := ws.retryDelayAfter(attempts); d != expected {
+			t.Errorf("retry delay after %d attempts is %s, expected %s", attempts, d, expected)
+		}
+	}
+}
+
+func TestWebhookSlowEndpoint(t *testing.T) {
+	hang := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer slow.Close()
+	defer close(hang)
+
+	delivered := make(chan struct{}, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer fast.Close()
+
+	ws, err := newWebhookService("", 2, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.add(webhook{URL: slow.URL, CoinType: "skycoin", Addrs: []string{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ws.add(webhook{URL: fast.URL, CoinType: "skycoin", Addrs: []string{"b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ws.handlePayment(payment{CoinType: "skycoin", Address: "a", Txid: "tx1", Coins: "1.000000", BlockSeq: 5})
+	ws.handlePayment(payment{CoinType: "skycoin", Address: "b", Txid: "tx2", Coins: "1.000000", BlockSeq: 5})
+	ws.onNewBlock("skycoin", 5)
+	ws.deliverDue()
+
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("a slow webhook should not delay the others")
+	}
+}
+
+func TestWebhookDeadLetterSize(t *testing.T) {
+	ws := &webhookService{}
+	for i := 0; i < webhookDeadLetterSize+10; i++ {
+		ws.deliveries = append(ws.deliveries, &delivery{ID: fmt.Sprint(i), State: deliveryDead})
+	}
+	ws.deliveries = append(ws.deliveries, &delivery{ID: "pending", State: deliveryPending})
+
+	ws.prune()
+
+	if len(ws.deliveries) != webhookDeadLetterSize+1 {
+		t.Fatalf("expected %d deliveries, got %d", webhookDeadLetterSize+1, len(ws.deliveries))
+	}
+	if ws.deliveries[0].ID != "10" || ws.find("pending") == nil {
+		t.Fatal("the oldest dead deliveries should be dropped")
+	}
+}